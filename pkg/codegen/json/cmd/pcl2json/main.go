@@ -0,0 +1,142 @@
+// Copyright 2016-2022, Pulumi Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// pcl2json binds a PCL program and prints its program.json serialization. It is intended for inspecting the output
+// of the JSON program generator while debugging.
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/pulumi/pulumi/pkg/v3/codegen/hcl2/syntax"
+	"github.com/pulumi/pulumi/pkg/v3/codegen/json"
+	"github.com/pulumi/pulumi/pkg/v3/codegen/pcl"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/diag"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/diag/colors"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource/plugin"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/util/contract"
+)
+
+func newPCL2JSONCmd() *cobra.Command {
+	var outputPath string
+
+	cmd := &cobra.Command{
+		Use:   "pcl2json [file]",
+		Short: "Print the program.json serialization of a PCL program",
+		Long: "Print the program.json serialization of a PCL program.\n" +
+			"\n" +
+			"The program is read from the given .pp file, or from standard input if no file or '-' is given.\n" +
+			"The result is written to standard output unless an output path is given with -o.",
+		Args:          cobra.MaximumNArgs(1),
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var source io.Reader = cmd.InOrStdin()
+			filename := "stdin.pp"
+			if len(args) == 1 && args[0] != "-" {
+				f, err := os.Open(args[0])
+				if err != nil {
+					return fmt.Errorf("could not open input: %w", err)
+				}
+				defer contract.IgnoreClose(f)
+				source, filename = f, filepath.Base(args[0])
+			}
+
+			programJSON, err := convert(source, filename, cmd.ErrOrStderr())
+			if err != nil {
+				return err
+			}
+
+			if outputPath == "" {
+				_, err = cmd.OutOrStdout().Write(programJSON)
+				return err
+			}
+			if err := os.WriteFile(outputPath, programJSON, 0600); err != nil {
+				return fmt.Errorf("could not write output: %w", err)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&outputPath, "out", "o", "", "The path to write program.json to")
+
+	return cmd
+}
+
+// convert parses and binds the PCL source and returns the generated program.json. Diagnostics are written to
+// diagnosticsOut.
+func convert(source io.Reader, filename string, diagnosticsOut io.Writer) ([]byte, error) {
+	parser := syntax.NewParser()
+	if err := parser.ParseFile(source, filename); err != nil {
+		return nil, fmt.Errorf("could not read input: %w", err)
+	}
+	diagnostics := parser.NewDiagnosticWriter(diagnosticsOut, 0, false)
+	if parser.Diagnostics.HasErrors() {
+		contract.IgnoreError(diagnostics.WriteDiagnostics(parser.Diagnostics))
+		return nil, fmt.Errorf("failed to parse %v", filename)
+	}
+
+	host, err := newPluginHost(diagnosticsOut)
+	if err != nil {
+		return nil, fmt.Errorf("could not create plugin host: %w", err)
+	}
+	defer contract.IgnoreClose(host)
+
+	program, bindDiagnostics, err := pcl.BindProgram(parser.Files, pcl.PluginHost(host))
+	if err != nil {
+		return nil, fmt.Errorf("could not bind program: %w", err)
+	}
+	contract.IgnoreError(diagnostics.WriteDiagnostics(bindDiagnostics))
+	if bindDiagnostics.HasErrors() {
+		return nil, fmt.Errorf("failed to bind %v", filename)
+	}
+
+	files, genDiagnostics, err := json.GenerateProgram(program)
+	if err != nil {
+		return nil, fmt.Errorf("could not generate program.json: %w", err)
+	}
+	contract.IgnoreError(diagnostics.WriteDiagnostics(genDiagnostics))
+	if genDiagnostics.HasErrors() {
+		return nil, fmt.Errorf("failed to generate program.json for %v", filename)
+	}
+
+	return files["program.json"], nil
+}
+
+func newPluginHost(diagnosticsOut io.Writer) (plugin.Host, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	sink := diag.DefaultSink(diagnosticsOut, diagnosticsOut, diag.FormatOptions{
+		Color: colors.Never,
+	})
+	pluginCtx, err := plugin.NewContext(sink, sink, nil, nil, cwd, nil, true, nil)
+	if err != nil {
+		return nil, err
+	}
+	return pluginCtx.Host, nil
+}
+
+func main() {
+	if err := newPCL2JSONCmd().Execute(); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
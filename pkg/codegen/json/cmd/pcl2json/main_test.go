@@ -0,0 +1,115 @@
+// Copyright 2016-2022, Pulumi Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pulumi/pulumi/pkg/v3/codegen/json"
+)
+
+// buildPCL2JSON compiles the pcl2json binary into a temporary directory and returns its path.
+func buildPCL2JSON(t *testing.T) string {
+	binary := filepath.Join(t.TempDir(), "pcl2json")
+	if runtime.GOOS == "windows" {
+		binary += ".exe"
+	}
+	out, err := exec.Command("go", "build", "-o", binary, ".").CombinedOutput()
+	require.NoError(t, err, "failed to build pcl2json: %s", out)
+	return binary
+}
+
+func requireProgramJSON(t *testing.T, programJSON []byte) {
+	program, err := json.ParseProgram(programJSON)
+	require.NoError(t, err)
+	assert.Equal(t, json.FormatVersion, program.FormatVersion)
+
+	names := []string{}
+	for _, node := range program.Nodes {
+		switch node := node.(type) {
+		case *json.ConfigVariable:
+			names = append(names, node.Name)
+		case *json.LocalVariable:
+			names = append(names, node.Name)
+		case *json.OutputVariable:
+			names = append(names, node.Name)
+		}
+	}
+	assert.ElementsMatch(t, []string{"names", "greeting", "count"}, names)
+}
+
+func TestPCL2JSON(t *testing.T) {
+	t.Parallel()
+
+	binary := buildPCL2JSON(t)
+	fixture := filepath.Join("testdata", "program.pp")
+
+	t.Run("file", func(t *testing.T) {
+		t.Parallel()
+
+		var stdout, stderr bytes.Buffer
+		cmd := exec.Command(binary, fixture)
+		cmd.Stdout, cmd.Stderr = &stdout, &stderr
+		require.NoError(t, cmd.Run(), "pcl2json failed: %s", stderr.String())
+		requireProgramJSON(t, stdout.Bytes())
+	})
+
+	t.Run("stdin", func(t *testing.T) {
+		t.Parallel()
+
+		source, err := os.ReadFile(fixture)
+		require.NoError(t, err)
+
+		var stdout, stderr bytes.Buffer
+		cmd := exec.Command(binary, "-")
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = bytes.NewReader(source), &stdout, &stderr
+		require.NoError(t, cmd.Run(), "pcl2json failed: %s", stderr.String())
+		requireProgramJSON(t, stdout.Bytes())
+	})
+
+	t.Run("output path", func(t *testing.T) {
+		t.Parallel()
+
+		outputPath := filepath.Join(t.TempDir(), "program.json")
+
+		var stdout, stderr bytes.Buffer
+		cmd := exec.Command(binary, "-o", outputPath, fixture)
+		cmd.Stdout, cmd.Stderr = &stdout, &stderr
+		require.NoError(t, cmd.Run(), "pcl2json failed: %s", stderr.String())
+		assert.Empty(t, stdout.String())
+
+		programJSON, err := os.ReadFile(outputPath)
+		require.NoError(t, err)
+		requireProgramJSON(t, programJSON)
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		t.Parallel()
+
+		var stderr bytes.Buffer
+		cmd := exec.Command(binary, filepath.Join("testdata", "missing.pp"))
+		cmd.Stderr = &stderr
+		assert.Error(t, cmd.Run())
+		assert.Contains(t, stderr.String(), "could not open input")
+	})
+}
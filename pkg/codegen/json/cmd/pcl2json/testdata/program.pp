@@ -0,0 +1,9 @@
+config names "list(string)" {
+	default = ["a", "b"]
+}
+
+greeting = "hello ${names[0]}!"
+
+output count {
+	value = length(names)
+}
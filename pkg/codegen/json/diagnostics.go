@@ -0,0 +1,95 @@
+package json
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/pulumi/pulumi/pkg/v3/codegen/hcl2/model"
+	"github.com/pulumi/pulumi/pkg/v3/codegen/pcl"
+)
+
+func warningf(subject hcl.Range, f string, args ...interface{}) *hcl.Diagnostic {
+	return diagf(hcl.DiagWarning, subject, f, args...)
+}
+
+// diagnosticPrefix starts the summary of every diagnostic reported by this package so that tools can tell them apart
+// from the diagnostics of the binder.
+const diagnosticPrefix = "json-codegen: "
+
+// diagf returns a diagnostic with the given severity. Warnings describe constructs that were dropped or replaced by a
+// placeholder, and errors describe constructs that are required but cannot be represented.
+func diagf(severity hcl.DiagnosticSeverity, subject hcl.Range, f string, args ...interface{}) *hcl.Diagnostic {
+	message := fmt.Sprintf(f, args...)
+	return &hcl.Diagnostic{
+		Severity: severity,
+		Summary:  diagnosticPrefix + message,
+		Detail:   message,
+		Subject:  &subject,
+	}
+}
+
+// syntaxRange returns the source range of the given syntax node, if any. Expressions that were constructed rather
+// than bound may not have a syntax node.
+func syntaxRange(node hclsyntax.Node) hcl.Range {
+	if node == nil {
+		return hcl.Range{}
+	}
+	return node.Range()
+}
+
+func unsupportedExpressionType(expr model.Expression) *hcl.Diagnostic {
+	return warningf(syntaxRange(expr.SyntaxNode()), "unsupported expression type %T was not serialized", expr)
+}
+
+func unsupportedNodeType(node pcl.Node) *hcl.Diagnostic {
+	return warningf(syntaxRange(node.SyntaxNode()), "unsupported node type %T was not serialized", node)
+}
+
+func localVariableCycle(expr model.Expression, local *pcl.LocalVariable) *hcl.Diagnostic {
+	return diagf(hcl.DiagError, syntaxRange(expr.SyntaxNode()),
+		"local variable %v refers to itself and cannot be inlined", local.Name())
+}
+
+func unresolvedDependency(expr model.Expression) *hcl.Diagnostic {
+	return warningf(syntaxRange(expr.SyntaxNode()),
+		"dependsOn entry does not refer directly to a node and was not resolved")
+}
+
+func unsupportedAliasField(key model.Expression) *hcl.Diagnostic {
+	return warningf(syntaxRange(key.SyntaxNode()),
+		"alias field is not one of name, type, parent, stack, or project and was not serialized")
+}
+
+func unboundAliases(expr model.Expression) *hcl.Diagnostic {
+	return warningf(syntaxRange(expr.SyntaxNode()),
+		"aliases are not supported by the PCL binder and were serialized from a program that failed to bind")
+}
+
+func missingValue(name string, subject hclsyntax.Node) *hcl.Diagnostic {
+	return diagf(hcl.DiagError, syntaxRange(subject), "%v has no value", name)
+}
+
+func emptyProgram() *hcl.Diagnostic {
+	return diagf(hcl.DiagError, hcl.Range{}, "program has no resources, variables, or outputs")
+}
+
+// jsonPath returns a printable form of the path to a value within a program.json document.
+func jsonPath(path string) string {
+	if path == "" {
+		return "document"
+	}
+	return path
+}
+
+func invalidJSONValue(path string, err error) *hcl.Diagnostic {
+	return diagf(hcl.DiagError, hcl.Range{}, "%v: %v", jsonPath(path), err)
+}
+
+func missingJSONField(path, name string) *hcl.Diagnostic {
+	return diagf(hcl.DiagError, hcl.Range{}, "%v: missing required field %q", jsonPath(path), name)
+}
+
+func unknownJSONType(path, kind, typ string) *hcl.Diagnostic {
+	return diagf(hcl.DiagError, hcl.Range{}, "%v: unknown %v type %q", jsonPath(path), kind, typ)
+}
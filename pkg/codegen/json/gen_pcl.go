@@ -0,0 +1,781 @@
+// Copyright 2016-2022, Pulumi Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package json
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+
+	"github.com/pulumi/pulumi/pkg/v3/codegen/pcl"
+)
+
+// The precedence levels used to decide where parentheses are required when rendering expressions. Higher levels bind
+// more tightly.
+const (
+	precedenceConditional = iota
+	precedenceLogicalOr
+	precedenceLogicalAnd
+	precedenceEquality
+	precedenceComparison
+	precedenceAdditive
+	precedenceMultiplicative
+	precedenceUnary
+	precedencePrimary
+)
+
+// binaryOperators maps the operation names emitted in program.json to their PCL operators and precedences.
+var binaryOperators = map[string]struct {
+	token      string
+	precedence int
+}{
+	OperationLogicalOr:          {"||", precedenceLogicalOr},
+	OperationLogicalAnd:         {"&&", precedenceLogicalAnd},
+	OperationEquals:             {"==", precedenceEquality},
+	OperationNotEquals:          {"!=", precedenceEquality},
+	OperationGreaterThan:        {">", precedenceComparison},
+	OperationGreaterThanOrEqual: {">=", precedenceComparison},
+	OperationLessThan:           {"<", precedenceComparison},
+	OperationLessThanOrEqual:    {"<=", precedenceComparison},
+	OperationAdd:                {"+", precedenceAdditive},
+	OperationSubtract:           {"-", precedenceAdditive},
+	OperationMultiply:           {"*", precedenceMultiplicative},
+	OperationDivide:             {"/", precedenceMultiplicative},
+	OperationModulo:             {"%", precedenceMultiplicative},
+}
+
+// unaryOperators maps the operation names emitted in program.json to their PCL operators.
+var unaryOperators = map[string]string{
+	OperationNegate: "-",
+	OperationNot:    "!",
+}
+
+type pclGenerator struct {
+	indent      string
+	diagnostics hcl.Diagnostics
+	// nodeNames maps the ID of each node in the program to its name, and is used to render node references.
+	nodeNames map[string]string
+}
+
+// GeneratePCL renders a program.json document as PCL source. This is the reverse of GenerateProgram: resources,
+// local variables, outputs, and config variables are reconstructed along with their expressions. Constructs that
+// cannot be expressed in PCL produce a diagnostic and are rendered as null.
+func GeneratePCL(programJSON []byte) (string, hcl.Diagnostics, error) {
+	program, err := ParseProgram(programJSON)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// Render the nodes in the order in which they were declared rather than in dependency order. Resources that were
+	// grouped by package are merged back into the other nodes.
+	nodes := make([]Node, len(program.Nodes))
+	copy(nodes, program.Nodes)
+	packages := make([]string, 0, len(program.Resources))
+	for pkg := range program.Resources {
+		packages = append(packages, pkg)
+	}
+	sort.Strings(packages)
+	for _, pkg := range packages {
+		nodes = append(nodes, program.Resources[pkg]...)
+	}
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return nodeSourceIndex(nodes[i]) < nodeSourceIndex(nodes[j])
+	})
+
+	g := &pclGenerator{nodeNames: nodeNames(nodes)}
+	var w bytes.Buffer
+	for i, node := range nodes {
+		if i > 0 {
+			fmt.Fprintln(&w)
+		}
+		g.genNode(&w, node)
+	}
+	return w.String(), g.diagnostics, nil
+}
+
+// nodeNames returns a map from the ID of each of the given nodes to its name.
+func nodeNames(nodes []Node) map[string]string {
+	names := make(map[string]string, len(nodes))
+	for _, node := range nodes {
+		var name, logicalName string
+		switch node := node.(type) {
+		case *Resource:
+			name, logicalName = node.Name, node.LogicalName
+		case *OutputVariable:
+			name, logicalName = node.Name, node.LogicalName
+		case *LocalVariable:
+			name, logicalName = node.Name, node.LogicalName
+		case *ConfigVariable:
+			name, logicalName = node.Name, node.LogicalName
+		}
+		if logicalName == "" {
+			logicalName = name
+		}
+		names[node.NodeType()+"::"+logicalName] = name
+	}
+	return names
+}
+
+// nodeSourceIndex returns the source index of the given node.
+func nodeSourceIndex(node Node) int {
+	switch node := node.(type) {
+	case *Resource:
+		return node.SourceIndex
+	case *OutputVariable:
+		return node.SourceIndex
+	case *LocalVariable:
+		return node.SourceIndex
+	case *ConfigVariable:
+		return node.SourceIndex
+	default:
+		return 0
+	}
+}
+
+// indented bumps the current indentation level, invokes the given function, and then resets the indentation level.
+func (g *pclGenerator) indented(f func()) {
+	g.indent += "\t"
+	f()
+	g.indent = g.indent[:len(g.indent)-1]
+}
+
+func (g *pclGenerator) genNode(w io.Writer, node Node) {
+	switch node := node.(type) {
+	case *Resource:
+		g.genResource(w, node)
+	case *OutputVariable:
+		fmt.Fprintf(w, "output %s", node.Name)
+		g.genTypeLabel(w, "output", node.Name, node.OutputType, node.Range)
+		fmt.Fprintf(w, " {\n")
+		g.indented(func() {
+			g.genLogicalName(w, node.Name, node.LogicalName)
+			g.genAttribute(w, "value", node.Value)
+		})
+		fmt.Fprintf(w, "}\n")
+	case *LocalVariable:
+		g.genAttribute(w, node.Name, node.Value)
+	case *ConfigVariable:
+		g.genConfigVariable(w, node)
+	}
+}
+
+func (g *pclGenerator) genResource(w io.Writer, resource *Resource) {
+	fmt.Fprintf(w, "resource %s %s {\n", resource.Name, quoteString(resource.Token))
+	g.indented(func() {
+		g.genLogicalName(w, resource.Name, resource.LogicalName)
+
+		// Attributes are rendered in source order. Any attributes that are missing from the recorded order are
+		// rendered afterwards in sorted order.
+		names := make([]string, 0, len(resource.Attributes))
+		seen := map[string]bool{}
+		for _, name := range resource.AttributeOrder {
+			if _, ok := resource.Attributes[name]; ok && !seen[name] {
+				names, seen[name] = append(names, name), true
+			}
+		}
+		var unordered []string
+		for name := range resource.Attributes {
+			if !seen[name] {
+				unordered = append(unordered, name)
+			}
+		}
+		sort.Strings(unordered)
+		for _, name := range append(names, unordered...) {
+			g.genAttribute(w, name, resource.Attributes[name].Value)
+		}
+
+		if options := resource.Options; options != nil {
+			fmt.Fprintf(w, "%soptions {\n", g.indent)
+			g.indented(func() {
+				if options.Range != nil {
+					g.genAttribute(w, "range", options.Range.Expression)
+				}
+				g.genAttribute(w, "parent", options.Parent)
+				g.genAttribute(w, "provider", options.Provider)
+				g.genListAttribute(w, "dependsOn", options.DependsOn)
+				g.genAttribute(w, "protect", options.Protect)
+				g.genListAttribute(w, "ignoreChanges", options.IgnoreChanges)
+				g.genAttribute(w, "version", options.Version)
+				g.genAttribute(w, "pluginDownloadURL", options.PluginDownloadURL)
+				g.genAliases(w, options.Aliases)
+			})
+			fmt.Fprintf(w, "%s}\n", g.indent)
+		}
+	})
+	fmt.Fprintf(w, "}\n")
+}
+
+func (g *pclGenerator) genConfigVariable(w io.Writer, config *ConfigVariable) {
+	fmt.Fprintf(w, "config %s", config.Name)
+	g.genTypeLabel(w, "config", config.Name, config.ConfigType, config.Range)
+	fmt.Fprintf(w, " {\n")
+	g.indented(func() {
+		g.genLogicalName(w, config.Name, config.LogicalName)
+		g.genAttribute(w, "default", config.DefaultValue)
+		if config.Description != "" {
+			fmt.Fprintf(w, "%sdescription = %s\n", g.indent, quoteString(config.Description))
+		}
+		if config.Nullable {
+			fmt.Fprintf(w, "%snullable = true\n", g.indent)
+		}
+	})
+	fmt.Fprintf(w, "}\n")
+}
+
+// genLogicalName writes a logical name attribute if the logical name differs from the node's name.
+func (g *pclGenerator) genLogicalName(w io.Writer, name, logicalName string) {
+	if logicalName != "" && logicalName != name {
+		fmt.Fprintf(w, "%s%s = %s\n", g.indent, pcl.LogicalNamePropertyKey, quoteString(logicalName))
+	}
+}
+
+// genAttribute writes an attribute. Absent values are skipped.
+func (g *pclGenerator) genAttribute(w io.Writer, name string, value Expression) {
+	if value == nil {
+		return
+	}
+	fmt.Fprintf(w, "%s%s = ", g.indent, name)
+	g.genExpression(w, value)
+	fmt.Fprintln(w)
+}
+
+// genListAttribute writes an attribute whose value is a list of expressions. Empty lists are skipped.
+func (g *pclGenerator) genListAttribute(w io.Writer, name string, values []Expression) {
+	if len(values) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "%s%s = ", g.indent, name)
+	g.genList(w, values)
+	fmt.Fprintln(w)
+}
+
+// genAsset writes a call to the builtin function that constructs the asset or archive of the given type and kind.
+func (g *pclGenerator) genAsset(w io.Writer, typ, kind string, argument Expression, rng *SourceRange) {
+	for name, function := range assetFunctions {
+		if function.typ == typ && function.kind == kind {
+			fmt.Fprintf(w, "%s(", name)
+			g.genExpression(w, argument)
+			fmt.Fprint(w, ")")
+			return
+		}
+	}
+	g.genUnsupported(w, rng, "%s kind %q", strings.ToLower(typ), kind)
+}
+
+// genAliases writes the aliases option of a resource. Empty lists are skipped.
+func (g *pclGenerator) genAliases(w io.Writer, aliases []Alias) {
+	if len(aliases) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "%saliases = [", g.indent)
+	for i, alias := range aliases {
+		if i > 0 {
+			fmt.Fprint(w, ", ")
+		}
+		if alias.Value != nil {
+			g.genExpression(w, alias.Value)
+			continue
+		}
+
+		fields := []struct {
+			name  string
+			value Expression
+		}{
+			{"name", alias.Name},
+			{"type", alias.Type},
+			{"parent", alias.Parent},
+			{"stack", alias.Stack},
+			{"project", alias.Project},
+		}
+		fmt.Fprint(w, "{")
+		first := true
+		for _, field := range fields {
+			if field.value == nil {
+				continue
+			}
+			if !first {
+				fmt.Fprint(w, ",")
+			}
+			first = false
+			fmt.Fprintf(w, " %s = ", field.name)
+			g.genExpression(w, field.value)
+		}
+		fmt.Fprint(w, " }")
+	}
+	fmt.Fprintln(w, "]")
+}
+
+func (g *pclGenerator) genList(w io.Writer, values []Expression) {
+	fmt.Fprint(w, "[")
+	for i, value := range values {
+		if i > 0 {
+			fmt.Fprint(w, ", ")
+		}
+		g.genExpression(w, value)
+	}
+	fmt.Fprint(w, "]")
+}
+
+// genTypeLabel renders the type label of a config or output block. Absent and dynamic types have no label.
+func (g *pclGenerator) genTypeLabel(w io.Writer, block, name string, t *Type, rng *SourceRange) {
+	if t == nil || t.Kind == "dynamic" {
+		return
+	}
+	if typ, ok := g.typeString(t); ok {
+		fmt.Fprintf(w, " %s", quoteString(typ))
+		return
+	}
+	g.diagnostics = append(g.diagnostics, warningf(sourceRange(rng),
+		"%s type %q of %s cannot be expressed in PCL", block, t.Kind, name))
+}
+
+// typeString renders a serialized type in the syntax accepted by config type labels.
+func (g *pclGenerator) typeString(t *Type) (string, bool) {
+	switch t.Kind {
+	case "string", "number", "int", "bool":
+		return t.Kind, true
+	case "list", "set", "map":
+		if t.ElementType == nil {
+			return "", false
+		}
+		element, ok := g.typeString(t.ElementType)
+		return fmt.Sprintf("%s(%s)", t.Kind, element), ok
+	case "tuple":
+		elements := make([]string, len(t.ElementTypes))
+		for i, elementType := range t.ElementTypes {
+			element, ok := g.typeString(elementType)
+			if !ok {
+				return "", false
+			}
+			elements[i] = element
+		}
+		return fmt.Sprintf("tuple([%s])", strings.Join(elements, ", ")), true
+	case "object":
+		names := make([]string, 0, len(t.Properties))
+		for name := range t.Properties {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		properties := make([]string, len(names))
+		for i, name := range names {
+			property, ok := g.typeString(t.Properties[name])
+			if !ok {
+				return "", false
+			}
+			properties[i] = fmt.Sprintf("%s = %s", name, property)
+		}
+		return fmt.Sprintf("object({%s})", strings.Join(properties, ", ")), true
+	default:
+		return "", false
+	}
+}
+
+// precedence returns the precedence level of the given expression.
+func precedence(expr Expression) int {
+	switch expr := expr.(type) {
+	case *ConditionalExpression:
+		return precedenceConditional
+	case *BinaryOpExpression:
+		if op, ok := binaryOperators[expr.Operation]; ok {
+			return op.precedence
+		}
+		return precedenceConditional
+	case *UnaryOpExpression:
+		return precedenceUnary
+	default:
+		return precedencePrimary
+	}
+}
+
+// genOperand writes an operand of an expression with the given precedence, parenthesizing it if necessary. Operands
+// that appear on the right-hand side of a left-associative operator must bind strictly more tightly.
+func (g *pclGenerator) genOperand(w io.Writer, expr Expression, parentPrecedence int, rhs bool) {
+	p := precedence(expr)
+	if p < parentPrecedence || (rhs && p == parentPrecedence) {
+		fmt.Fprint(w, "(")
+		g.genExpression(w, expr)
+		fmt.Fprint(w, ")")
+		return
+	}
+	g.genExpression(w, expr)
+}
+
+func (g *pclGenerator) genExpression(w io.Writer, expr Expression) {
+	switch expr := expr.(type) {
+	case nil:
+		fmt.Fprint(w, "null")
+	case *LiteralValueExpression:
+		g.genLiteralValue(w, expr.Value)
+	case *TemplateExpression:
+		fmt.Fprint(w, `"`)
+		g.genTemplateParts(w, expr.Parts)
+		fmt.Fprint(w, `"`)
+	case *TemplateJoinExpression:
+		// Template joins are only meaningful within a template.
+		fmt.Fprint(w, `"`)
+		g.genTemplatePart(w, expr)
+		fmt.Fprint(w, `"`)
+	case *IndexExpression:
+		g.genOperand(w, expr.Collection, precedencePrimary, false)
+		// Literal keys are parenthesized so that they bind as an index expression rather than a traversal.
+		_, literal := expr.Key.(*LiteralValueExpression)
+		_, static := staticKey(expr.Key)
+		if literal || static {
+			fmt.Fprint(w, "[(")
+			g.genExpression(w, expr.Key)
+			fmt.Fprint(w, ")]")
+		} else {
+			fmt.Fprint(w, "[")
+			g.genExpression(w, expr.Key)
+			fmt.Fprint(w, "]")
+		}
+	case *ObjectConsExpression:
+		g.genObjectCons(w, expr)
+	case *TupleConsExpression:
+		g.genList(w, expr.Items)
+	case *FunctionCallExpression:
+		fmt.Fprintf(w, "%s(", expr.Name)
+		for i, arg := range expr.Args {
+			if i > 0 {
+				fmt.Fprint(w, ", ")
+			}
+			g.genExpression(w, arg)
+		}
+		fmt.Fprint(w, ")")
+	case *NamedArgument:
+		// PCL arguments are positional, so only the value is rendered.
+		g.genExpression(w, expr.Value)
+	case *Invoke:
+		g.genInvoke(w, expr)
+	case *Asset:
+		g.genAsset(w, expr.ExpressionType(), expr.Kind, expr.Argument, expr.Range)
+	case *Archive:
+		g.genAsset(w, expr.ExpressionType(), expr.Kind, expr.Argument, expr.Range)
+	case *NodeReference:
+		name, ok := g.nodeNames[expr.ID]
+		if !ok {
+			g.genUnsupported(w, expr.Range, "reference to unknown node %q", expr.ID)
+			return
+		}
+		fmt.Fprint(w, name)
+	case *NullExpression:
+		fmt.Fprint(w, "null")
+	case *NotImplemented:
+		fmt.Fprintf(w, "notImplemented(%s)", quoteString(expr.Message))
+	case *RelativeTraversalExpression:
+		g.genOperand(w, expr.Source, precedencePrimary, false)
+		genTraversal(w, expr.Traversal)
+	case *ScopeTraversalExpression:
+		fmt.Fprint(w, expr.RootName)
+		genTraversal(w, expr.Traversal)
+	case *BinaryOpExpression:
+		op, ok := binaryOperators[expr.Operation]
+		if !ok {
+			g.genUnsupported(w, expr.Range, "binary operation %q", expr.Operation)
+			return
+		}
+		g.genOperand(w, expr.Left, op.precedence, false)
+		fmt.Fprintf(w, " %s ", op.token)
+		g.genOperand(w, expr.Right, op.precedence, true)
+	case *UnaryOpExpression:
+		op, ok := unaryOperators[expr.Operation]
+		if !ok {
+			g.genUnsupported(w, expr.Range, "unary operation %q", expr.Operation)
+			return
+		}
+		fmt.Fprint(w, op)
+		g.genOperand(w, expr.Operand, precedenceUnary, false)
+	case *ConditionalExpression:
+		g.genOperand(w, expr.Condition, precedenceConditional, true)
+		fmt.Fprint(w, " ? ")
+		g.genExpression(w, expr.TrueResult)
+		fmt.Fprint(w, " : ")
+		g.genExpression(w, expr.FalseResult)
+	case *ForExpression:
+		g.genFor(w, expr)
+	case *SplatExpression:
+		g.genOperand(w, expr.Source, precedencePrimary, false)
+		fmt.Fprint(w, "[*]")
+		g.genExpression(w, expr.Each)
+	case *AnonymousFunctionExpression:
+		g.genUnsupported(w, expr.Range, "anonymous functions")
+	case *UnsupportedExpression:
+		g.genUnsupported(w, expr.Range, "expression type %s", expr.ExprType)
+	default:
+		g.genUnsupported(w, nil, "expression type %s", expr.ExpressionType())
+	}
+}
+
+// genUnsupported records a diagnostic for an expression that cannot be rendered and writes null in its place.
+func (g *pclGenerator) genUnsupported(w io.Writer, rng *SourceRange, f string, args ...interface{}) {
+	g.diagnostics = append(g.diagnostics, warningf(sourceRange(rng), "%s cannot be expressed in PCL",
+		fmt.Sprintf(f, args...)))
+	fmt.Fprint(w, "null")
+}
+
+func (g *pclGenerator) genLiteralValue(w io.Writer, value interface{}) {
+	switch value := value.(type) {
+	case nil:
+		fmt.Fprint(w, "null")
+	case bool:
+		fmt.Fprintf(w, "%v", value)
+	case json.Number:
+		fmt.Fprint(w, value.String())
+	case string:
+		fmt.Fprint(w, quoteString(value))
+	case []interface{}:
+		fmt.Fprint(w, "[")
+		for i, element := range value {
+			if i > 0 {
+				fmt.Fprint(w, ", ")
+			}
+			g.genLiteralValue(w, element)
+		}
+		fmt.Fprint(w, "]")
+	case map[string]interface{}:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		fmt.Fprint(w, "{")
+		for i, key := range keys {
+			if i > 0 {
+				fmt.Fprint(w, ", ")
+			}
+			fmt.Fprintf(w, "%s = ", objectKey(key))
+			g.genLiteralValue(w, value[key])
+		}
+		fmt.Fprint(w, "}")
+	default:
+		g.genUnsupported(w, nil, "literal value of type %T", value)
+	}
+}
+
+func (g *pclGenerator) genTemplateParts(w io.Writer, parts []Expression) {
+	for _, part := range parts {
+		g.genTemplatePart(w, part)
+	}
+}
+
+func (g *pclGenerator) genTemplatePart(w io.Writer, part Expression) {
+	switch part := part.(type) {
+	case *LiteralValueExpression:
+		if s, ok := part.Value.(string); ok {
+			fmt.Fprint(w, escapeTemplateString(s))
+			return
+		}
+	case *TemplateJoinExpression:
+		// A template join is the lowered form of a template for directive.
+		if loop, ok := part.Tuple.(*ForExpression); ok && loop.Key == nil {
+			fmt.Fprint(w, "%{ for ")
+			if loop.KeyVariable != nil {
+				fmt.Fprintf(w, "%s, ", *loop.KeyVariable)
+			}
+			fmt.Fprintf(w, "%s in ", loop.ValueVariable)
+			g.genExpression(w, loop.Collection)
+			fmt.Fprint(w, " }")
+			if loop.Condition != nil {
+				fmt.Fprint(w, "%{ if ")
+				g.genExpression(w, loop.Condition)
+				fmt.Fprint(w, " }")
+			}
+			if template, ok := loop.Value.(*TemplateExpression); ok {
+				g.genTemplateParts(w, template.Parts)
+			} else {
+				g.genTemplatePart(w, loop.Value)
+			}
+			if loop.Condition != nil {
+				fmt.Fprint(w, "%{ endif }")
+			}
+			fmt.Fprint(w, "%{ endfor }")
+			return
+		}
+	}
+
+	fmt.Fprint(w, "${")
+	g.genExpression(w, part)
+	fmt.Fprint(w, "}")
+}
+
+func (g *pclGenerator) genObjectCons(w io.Writer, expr *ObjectConsExpression) {
+	if len(expr.Properties) == 0 {
+		fmt.Fprint(w, "{}")
+		return
+	}
+
+	fmt.Fprintln(w, "{")
+	g.indented(func() {
+		for _, property := range expr.Properties {
+			fmt.Fprint(w, g.indent)
+			if key, ok := staticKey(property.Key); ok {
+				fmt.Fprint(w, objectKey(key))
+			} else {
+				fmt.Fprint(w, "(")
+				g.genExpression(w, property.Key)
+				fmt.Fprint(w, ")")
+			}
+			fmt.Fprint(w, " = ")
+			g.genExpression(w, property.Value)
+			fmt.Fprintln(w)
+		}
+	})
+	fmt.Fprintf(w, "%s}", g.indent)
+}
+
+func (g *pclGenerator) genInvoke(w io.Writer, expr *Invoke) {
+	fmt.Fprintf(w, "%s(%s, ", pcl.Invoke, quoteString(expr.Token))
+
+	names := make([]string, 0, len(expr.Args))
+	for name := range expr.Args {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	args := &ObjectConsExpression{}
+	for _, name := range names {
+		args.Properties = append(args.Properties, ObjectConsProperty{
+			Key:   &LiteralValueExpression{Value: name},
+			Value: expr.Args[name],
+		})
+	}
+	g.genObjectCons(w, args)
+
+	if expr.Options != nil {
+		fmt.Fprint(w, ", ")
+		g.genExpression(w, expr.Options)
+	}
+	fmt.Fprint(w, ")")
+}
+
+func (g *pclGenerator) genFor(w io.Writer, expr *ForExpression) {
+	openBrace, closeBrace := "[", "]"
+	if expr.Key != nil {
+		openBrace, closeBrace = "{", "}"
+	}
+
+	fmt.Fprintf(w, "%sfor ", openBrace)
+	if expr.KeyVariable != nil {
+		fmt.Fprintf(w, "%s, ", *expr.KeyVariable)
+	}
+	fmt.Fprintf(w, "%s in ", expr.ValueVariable)
+	g.genExpression(w, expr.Collection)
+	fmt.Fprint(w, ": ")
+	if expr.Key != nil {
+		g.genExpression(w, expr.Key)
+		fmt.Fprint(w, " => ")
+	}
+	g.genExpression(w, expr.Value)
+	if expr.Group {
+		fmt.Fprint(w, "...")
+	}
+	if expr.Condition != nil {
+		fmt.Fprint(w, " if ")
+		g.genExpression(w, expr.Condition)
+	}
+	fmt.Fprint(w, closeBrace)
+}
+
+// genTraversal writes the parts of a traversal that follow its root. The root itself is written by the caller.
+func genTraversal(w io.Writer, traversal []Traverser) {
+	for _, part := range traversal {
+		switch part.Type {
+		case "TraverseAttr":
+			fmt.Fprintf(w, ".%s", part.Name)
+		case "TraverseIndex":
+			if part.Key != nil {
+				fmt.Fprintf(w, "[%s]", quoteString(*part.Key))
+			} else {
+				fmt.Fprintf(w, "[%s]", part.Index)
+			}
+		case "TraverseSplat":
+			fmt.Fprint(w, ".*")
+		}
+	}
+}
+
+// staticKey returns the value of an object key that is a string literal or a template with a single literal part.
+func staticKey(key Expression) (string, bool) {
+	switch key := key.(type) {
+	case *LiteralValueExpression:
+		s, ok := key.Value.(string)
+		return s, ok
+	case *TemplateExpression:
+		if len(key.Parts) == 1 {
+			return staticKey(key.Parts[0])
+		}
+	}
+	return "", false
+}
+
+// objectKey renders a static object key, quoting it if it is not a valid identifier.
+func objectKey(key string) string {
+	if hclsyntax.ValidIdentifier(key) {
+		return key
+	}
+	return quoteString(key)
+}
+
+// quoteString renders a string as a quoted PCL template with no interpolations.
+func quoteString(s string) string {
+	return `"` + escapeTemplateString(s) + `"`
+}
+
+// escapeTemplateString escapes a string for inclusion in a quoted template.
+func escapeTemplateString(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '$', '%':
+			b.WriteByte(c)
+			if i+1 < len(s) && s[i+1] == '{' {
+				b.WriteByte(c)
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// sourceRange converts a serialized source range into an hcl.Range. Absent ranges produce an empty range.
+func sourceRange(rng *SourceRange) hcl.Range {
+	if rng == nil {
+		return hcl.Range{}
+	}
+	return hcl.Range{
+		Filename: rng.Filename,
+		Start:    hcl.Pos{Line: rng.Start.Line, Column: rng.Start.Column, Byte: rng.Start.Byte},
+		End:      hcl.Pos{Line: rng.End.Line, Column: rng.End.Column, Byte: rng.End.Byte},
+	}
+}
@@ -0,0 +1,230 @@
+package json
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGeneratePCLRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	source := `
+config names "list(string)" {
+	default = ["a", "b"]
+	description = "The \"names\" of the pets"
+}
+config weights "map(number)" {}
+
+resource pets "random:index/randomPet:RandomPet" {
+	options {
+		range = length(names)
+		protect = true
+	}
+	prefix = "${names[range.value]}-%{ for w, _ in weights }${w},%{ endfor }"
+	length = (range.value + 1) * 2 - -1
+	keepers = {
+		index = range.value
+		"with space" = !(range.value > 1 || false)
+		(names[0]) = { for k, v in weights: k => v... if v > 0 }
+	}
+}
+
+resource other "random:index/randomPet:RandomPet" {
+	__logicalName = "other-pet"
+	options {
+		dependsOn = [pets[0]]
+	}
+	separator = length(names) == 0 ? "-" : length(names) > 1 ? "_" : "."
+}
+
+upper = [for n in names: n if n != ""]
+heavy = weights["heavy"]
+
+output ids {
+	__logicalName = "petIds"
+	value = pets[*].id
+}
+`
+
+	requirePCLRoundTrip(t, source)
+}
+
+func TestGeneratePCLResourceOptionsInput(t *testing.T) {
+	t.Parallel()
+
+	requirePCLRoundTrip(t, `
+resource domain "aws-native:ec2:TransitGatewayMulticastDomain" {
+	transitGatewayId = "tgw-1234"
+	options = {
+		dnsSupport = "enable"
+	}
+	options {
+		protect = true
+	}
+}
+`)
+}
+
+func TestGeneratePCLNumberString(t *testing.T) {
+	t.Parallel()
+
+	generate := func(text string) []byte {
+		program, diags := parseAndBindProgram(t, text, "program.pp")
+		require.False(t, diags.HasErrors(), "failed to bind program: %v\n%v", diags, text)
+		files, _, err := GenerateProgramWithOptions(program, GenerateProgramOptions{NumberMode: NumberString})
+		require.NoError(t, err)
+		return files["program.json"]
+	}
+
+	expected := generate(`
+resource pet "random:index/randomPet:RandomPet" {
+	length = 2
+	prefix = "2"
+}
+`)
+
+	// Numbers emitted as strings are decoded as numbers.
+	parsed, err := ParseProgram(expected)
+	require.NoError(t, err)
+	length := parsed.Nodes[0].(*Resource).Attributes["length"].Value.(*LiteralValueExpression)
+	assert.Equal(t, "string", length.NumberMode)
+	assert.Equal(t, json.Number("2"), length.Value)
+
+	pclSource, diags, err := GeneratePCL(expected)
+	require.NoError(t, err)
+	require.Empty(t, diags)
+	assert.Contains(t, pclSource, "length = 2")
+	assert.Contains(t, pclSource, `prefix = "2"`)
+
+	assert.JSONEq(t, string(expected), string(generate(pclSource)), pclSource)
+}
+
+func TestGeneratePCLAliases(t *testing.T) {
+	t.Parallel()
+
+	source, diags, err := GeneratePCL([]byte(`{"nodes":[{
+		"type": "Resource",
+		"name": "pet",
+		"token": "random:index/randomPet:RandomPet",
+		"attributes": {},
+		"options": {"aliases": [
+			{
+				"name": {"type": "LiteralValueExpression", "value": "old-pet"},
+				"parent": {
+					"type": "ScopeTraversalExpression",
+					"rootName": "parent",
+					"traversal": [{"type": "TraverseRoot", "name": "parent"}]
+				}
+			},
+			{"value": {
+				"type": "LiteralValueExpression",
+				"value": "urn:pulumi:dev::pets::random:index/randomPet:RandomPet::legacy"
+			}}
+		]}
+	}],"packages":[]}`))
+	require.NoError(t, err)
+	assert.Empty(t, diags)
+	assert.Contains(t, source,
+		`aliases = [{ name = "old-pet", parent = parent }, "urn:pulumi:dev::pets::random:index/randomPet:RandomPet::legacy"]`)
+}
+
+func TestGeneratePCLAssets(t *testing.T) {
+	t.Parallel()
+
+	requirePCLRoundTrip(t, `
+config dir "string" {}
+
+file = fileAsset("${dir}/index.html")
+remote = remoteAsset("https://example.com/index.html")
+text = stringAsset("<html></html>")
+archive = fileArchive("./site")
+remoteSite = remoteArchive("https://example.com/site.zip")
+`)
+}
+
+func TestGeneratePCLOutputType(t *testing.T) {
+	t.Parallel()
+
+	requirePCLRoundTrip(t, `
+config names "list(string)" {}
+
+output count "int" {
+	value = length(names)
+}
+`)
+}
+
+func TestGeneratePCLRelativeTraversal(t *testing.T) {
+	t.Parallel()
+
+	requirePCLRoundTrip(t, `
+config csv "string" {}
+
+deviceName = invoke("aws:index:getAmi", { owners = ["137112412989"] }).blockDeviceMappings[0].deviceName
+firstName = [{ name = csv }][(0)].name
+`)
+}
+
+// requirePCLRoundTrip asserts that rendering the program.json for the given source with GeneratePCL produces a
+// program with the same program.json.
+func requirePCLRoundTrip(t *testing.T, source string) {
+	generate := func(text string) []byte {
+		program, diags := parseAndBindProgram(t, text, "program.pp")
+		require.False(t, diags.HasErrors(), "failed to bind program: %v\n%v", diags, text)
+		files, diags, err := GenerateProgram(program)
+		require.NoError(t, err)
+		require.False(t, diags.HasErrors(), "failed to generate program: %v", diags)
+		return files["program.json"]
+	}
+
+	expected := generate(source)
+	pclSource, diags, err := GeneratePCL(expected)
+	require.NoError(t, err)
+	require.Empty(t, diags)
+
+	assert.JSONEq(t, string(expected), string(generate(pclSource)), pclSource)
+}
+
+func TestGeneratePCLNodeReference(t *testing.T) {
+	t.Parallel()
+
+	source, diags, err := GeneratePCL([]byte(`{"nodes":[{
+		"type": "Resource",
+		"name": "first",
+		"logicalName": "first-pet",
+		"token": "random:index/randomPet:RandomPet",
+		"attributes": {}
+	}, {
+		"type": "Resource",
+		"name": "second",
+		"token": "random:index/randomPet:RandomPet",
+		"attributes": {},
+		"options": {"dependsOn": [
+			{"type": "NodeReference", "id": "Resource::first-pet"},
+			{"type": "NodeReference", "id": "Resource::missing"}
+		]}
+	}],"packages":[]}`))
+	require.NoError(t, err)
+	assert.Contains(t, source, "dependsOn = [first, null]")
+	require.Len(t, diags, 1)
+	assert.Equal(t, `json-codegen: reference to unknown node "Resource::missing" cannot be expressed in PCL`,
+		diags[0].Summary)
+}
+
+func TestGeneratePCLUnsupported(t *testing.T) {
+	t.Parallel()
+
+	source, diags, err := GeneratePCL([]byte(`{"nodes":[{
+		"type": "LocalVariable",
+		"name": "x",
+		"logicalName": "x",
+		"value": {"type": "UnsupportedExpression", "exprType": "*model.ErrorExpression", "tokens": ""}
+	}],"packages":[]}`))
+	require.NoError(t, err)
+	assert.Equal(t, "x = null\n", source)
+	require.Len(t, diags, 1)
+	assert.Equal(t, "json-codegen: expression type *model.ErrorExpression cannot be expressed in PCL", diags[0].Summary)
+}
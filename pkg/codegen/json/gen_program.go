@@ -0,0 +1,2315 @@
+// Copyright 2016-2022, Pulumi Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package json serializes a bound PCL program into a JSON tree. Each node and expression is emitted as a JSON object
+// whose "type" field names the kind of construct it represents.
+//
+// The PCL binder does not yet support the aliases resource option and reports an error for it. Aliases are therefore
+// only serialized for programs that are generated despite their bind errors.
+package json
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/pulumi/pulumi/pkg/v3/codegen/hcl2/model"
+	"github.com/pulumi/pulumi/pkg/v3/codegen/pcl"
+	"github.com/pulumi/pulumi/pkg/v3/codegen/schema"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/encoding"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/workspace"
+	"github.com/zclconf/go-cty/cty"
+	"gopkg.in/yaml.v3"
+)
+
+// FormatVersion is the version of the program.json format emitted by this package. It is recorded in the
+// "formatVersion" field of each program and must be bumped whenever the shape of nodes or expressions changes.
+const FormatVersion = "4.0"
+
+// notImplemented is the name of the function that converters use to mark constructs that could not be converted to
+// PCL. Its single argument describes the unconverted construct.
+const notImplemented = "notImplemented"
+
+// collectionHelpers holds the names of the builtin functions that build or query collections. Calls to these functions
+// are tagged with a "helperKind" so that consumers can special-case them.
+var collectionHelpers = map[string]bool{
+	"element": true,
+	"entries": true,
+	"lookup":  true,
+	"range":   true,
+}
+
+// assetFunction describes a builtin function that constructs an asset or an archive.
+type assetFunction struct {
+	// typ is the type of the emitted expression, either "Asset" or "Archive".
+	typ string
+	// kind is the source of the asset or archive: "file", "remote", or "string".
+	kind string
+}
+
+// assetFunctions maps the names of the builtin functions that construct assets and archives from a single path, URI,
+// or string to the asset or archive they construct. Calls to these functions are emitted as Asset and Archive
+// expressions so that deployment tooling can resolve asset paths without interpreting function calls.
+var assetFunctions = map[string]assetFunction{
+	"fileAsset":     {typ: "Asset", kind: "file"},
+	"remoteAsset":   {typ: "Asset", kind: "remote"},
+	"stringAsset":   {typ: "Asset", kind: "string"},
+	"fileArchive":   {typ: "Archive", kind: "file"},
+	"remoteArchive": {typ: "Archive", kind: "remote"},
+}
+
+type generator struct {
+	program     *pcl.Program
+	options     GenerateProgramOptions
+	diagnostics hcl.Diagnostics
+
+	// inlining holds the local variables whose definitions are being inlined, and is used to detect cycles.
+	inlining map[*pcl.LocalVariable]bool
+	// objectKinds holds the kind of each object constructor whose kind is given by the schema type it is assigned to.
+	objectKinds map[*model.ObjectConsExpression]string
+	// keyEnumTypes holds the token of the enum type of each object key that names an enum-typed property in the
+	// schema.
+	keyEnumTypes map[model.Expression]string
+	// source holds the contents of the program's source files, keyed by filename. It is loaded on first use.
+	source map[string]string
+	// sourceIndices holds the position of each node in source order. It is computed on first use.
+	sourceIndices map[pcl.Node]int
+}
+
+// The operation names emitted in the "operation" field of BinaryOpExpression and UnaryOpExpression nodes.
+const (
+	// OperationLogicalOr is the name of the `||` operation.
+	OperationLogicalOr = "logicalOr"
+	// OperationLogicalAnd is the name of the `&&` operation.
+	OperationLogicalAnd = "logicalAnd"
+	// OperationEquals is the name of the `==` operation.
+	OperationEquals = "equals"
+	// OperationNotEquals is the name of the `!=` operation.
+	OperationNotEquals = "notEquals"
+	// OperationGreaterThan is the name of the `>` operation.
+	OperationGreaterThan = "greaterThan"
+	// OperationGreaterThanOrEqual is the name of the `>=` operation.
+	OperationGreaterThanOrEqual = "greaterThanOrEqual"
+	// OperationLessThan is the name of the `<` operation.
+	OperationLessThan = "lessThan"
+	// OperationLessThanOrEqual is the name of the `<=` operation.
+	OperationLessThanOrEqual = "lessThanOrEqual"
+	// OperationAdd is the name of the binary `+` operation.
+	OperationAdd = "add"
+	// OperationSubtract is the name of the binary `-` operation.
+	OperationSubtract = "subtract"
+	// OperationMultiply is the name of the `*` operation.
+	OperationMultiply = "multiply"
+	// OperationDivide is the name of the `/` operation.
+	OperationDivide = "divide"
+	// OperationModulo is the name of the `%` operation.
+	OperationModulo = "modulo"
+	// OperationNegate is the name of the unary `-` operation.
+	OperationNegate = "negate"
+	// OperationNot is the name of the `!` operation.
+	OperationNot = "not"
+	// OperationUnknown is emitted for operations that have no stable name.
+	OperationUnknown = "unknown"
+)
+
+// binaryOperationName returns the stable name of the given binary operation.
+func binaryOperationName(operation *hclsyntax.Operation) string {
+	switch operation {
+	case hclsyntax.OpLogicalOr:
+		return OperationLogicalOr
+	case hclsyntax.OpLogicalAnd:
+		return OperationLogicalAnd
+	case hclsyntax.OpEqual:
+		return OperationEquals
+	case hclsyntax.OpNotEqual:
+		return OperationNotEquals
+	case hclsyntax.OpGreaterThan:
+		return OperationGreaterThan
+	case hclsyntax.OpGreaterThanOrEqual:
+		return OperationGreaterThanOrEqual
+	case hclsyntax.OpLessThan:
+		return OperationLessThan
+	case hclsyntax.OpLessThanOrEqual:
+		return OperationLessThanOrEqual
+	case hclsyntax.OpAdd:
+		return OperationAdd
+	case hclsyntax.OpSubtract:
+		return OperationSubtract
+	case hclsyntax.OpMultiply:
+		return OperationMultiply
+	case hclsyntax.OpDivide:
+		return OperationDivide
+	case hclsyntax.OpModulo:
+		return OperationModulo
+	}
+	return OperationUnknown
+}
+
+// unaryOperationName returns the stable name of the given unary operation.
+func unaryOperationName(operation *hclsyntax.Operation) string {
+	switch operation {
+	case hclsyntax.OpNegate:
+		return OperationNegate
+	case hclsyntax.OpLogicalNot:
+		return OperationNot
+	}
+	return OperationUnknown
+}
+
+// transformTraversal transforms the parts of a traversal.
+func transformTraversal(traversal hcl.Traversal) []interface{} {
+	parts := make([]interface{}, 0, len(traversal))
+	for _, part := range traversal {
+		switch part := part.(type) {
+		case hcl.TraverseRoot:
+			parts = append(parts, map[string]interface{}{
+				"type": "TraverseRoot",
+				"name": part.Name,
+			})
+		case hcl.TraverseAttr:
+			parts = append(parts, map[string]interface{}{
+				"type": "TraverseAttr",
+				"name": part.Name,
+			})
+		case hcl.TraverseIndex:
+			// Numeric keys are emitted as an index; string keys (e.g. `m["key"]`) are emitted as a key.
+			traverser := map[string]interface{}{"type": "TraverseIndex"}
+			if part.Key.Type() == cty.Number {
+				traverser["index"] = transformNumber(part.Key)
+			} else {
+				traverser["key"] = ctyToJSON(part.Key, NumberNative)
+			}
+			parts = append(parts, traverser)
+		case hcl.TraverseSplat:
+			parts = append(parts, map[string]interface{}{
+				"type": "TraverseSplat",
+			})
+		}
+	}
+	return parts
+}
+
+// NumberMode selects how the values of number literals are emitted.
+type NumberMode int
+
+const (
+	// NumberNative emits numbers as JSON numbers. Integral values are emitted exactly, and fractional values are
+	// rounded to the nearest float64.
+	NumberNative NumberMode = iota
+	// NumberString emits numbers as JSON strings that hold the exact text of the number. Literals whose values are
+	// emitted this way carry a "numberMode" field set to "string".
+	NumberString
+	// NumberJSONNumber emits numbers as JSON numbers that hold the exact text of the number.
+	NumberJSONNumber
+)
+
+// transformNumber converts a cty number into a JSON number. Integral values are emitted exactly so that large
+// integers do not lose precision by passing through a float64.
+func transformNumber(value cty.Value) interface{} {
+	return transformNumberWithMode(value, NumberNative)
+}
+
+// transformNumberWithMode converts a cty number into its JSON form using the given number mode.
+func transformNumberWithMode(value cty.Value, mode NumberMode) interface{} {
+	number := value.AsBigFloat()
+	text := number.Text('f', 0)
+	if !number.IsInt() {
+		text = number.Text('g', -1)
+	}
+
+	switch {
+	case mode == NumberString:
+		return text
+	case mode == NumberJSONNumber || number.IsInt():
+		return json.Number(text)
+	}
+	f, _ := number.Float64()
+	return f
+}
+
+// ctyTypeSupported returns true if values of the given type can be converted by ctyToJSON. Sets are not supported, as
+// their elements have no stable order.
+func ctyTypeSupported(t cty.Type) bool {
+	switch {
+	case t == cty.Bool || t == cty.Number || t == cty.String:
+		return true
+	case t.IsListType() || t.IsMapType():
+		return ctyTypeSupported(t.ElementType())
+	case t.IsTupleType():
+		for _, element := range t.TupleElementTypes() {
+			if !ctyTypeSupported(element) {
+				return false
+			}
+		}
+		return true
+	case t.IsObjectType():
+		for _, attribute := range t.AttributeTypes() {
+			if !ctyTypeSupported(attribute) {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// ctyToJSON converts a known cty value of a supported type into its JSON form. Tuples and lists become arrays, and
+// objects and maps become objects. Null values become nil. Numbers are converted according to the given mode.
+func ctyToJSON(v cty.Value, mode NumberMode) interface{} {
+	if v.IsNull() {
+		return nil
+	}
+
+	t := v.Type()
+	switch {
+	case t == cty.Bool:
+		return v.True()
+	case t == cty.Number:
+		return transformNumberWithMode(v, mode)
+	case t == cty.String:
+		return v.AsString()
+	case t.IsTupleType() || t.IsListType():
+		elements := make([]interface{}, 0, v.LengthInt())
+		for it := v.ElementIterator(); it.Next(); {
+			_, element := it.Element()
+			elements = append(elements, ctyToJSON(element, mode))
+		}
+		return elements
+	case t.IsObjectType() || t.IsMapType():
+		object := make(map[string]interface{}, v.LengthInt())
+		for it := v.ElementIterator(); it.Next(); {
+			key, element := it.Element()
+			object[key.AsString()] = ctyToJSON(element, mode)
+		}
+		return object
+	default:
+		return nil
+	}
+}
+
+// ExpressionToJSON converts a bound expression into the form it takes in program.json. A nil expression converts to
+// nil. If the expression contains any subexpressions that cannot be serialized, the diagnostics that describe them
+// are returned as the error.
+func ExpressionToJSON(expr model.Expression) (map[string]interface{}, error) {
+	if expr == nil {
+		return nil, nil
+	}
+
+	g := &generator{}
+	result := g.transformExpression(expr)
+	if len(g.diagnostics) != 0 {
+		return nil, g.diagnostics
+	}
+	return result, nil
+}
+
+// foldConstants transforms an operator or conditional expression whose result is known without evaluating the program.
+// Operators are folded into a literal if all of their operands are constant, and conditionals with a constant
+// condition are replaced by the selected result.
+func (g *generator) foldConstants(expr model.Expression) (map[string]interface{}, bool) {
+	switch expr := expr.(type) {
+	case *model.BinaryOpExpression, *model.UnaryOpExpression:
+		if !isConstant(expr) {
+			return nil, false
+		}
+		value, diags := expr.Evaluate(&hcl.EvalContext{})
+		if diags.HasErrors() || !value.IsWhollyKnown() || !ctyTypeSupported(value.Type()) {
+			return nil, false
+		}
+		// Infinite results, e.g. of dividing by zero, have no JSON representation, so the operation is kept.
+		if value.Type() == cty.Number && !value.IsNull() && value.AsBigFloat().IsInf() {
+			return nil, false
+		}
+		return g.transformExpressionValue(&model.LiteralValueExpression{Value: value}), true
+	case *model.ConditionalExpression:
+		if !isConstant(expr.Condition) {
+			return nil, false
+		}
+		condition, diags := expr.Condition.Evaluate(&hcl.EvalContext{})
+		if diags.HasErrors() || condition.Type() != cty.Bool || !condition.IsKnown() || condition.IsNull() {
+			return nil, false
+		}
+		if condition.True() {
+			return g.transformExpression(expr.TrueResult), true
+		}
+		return g.transformExpression(expr.FalseResult), true
+	}
+	return nil, false
+}
+
+// isConstant returns true if the given expression is a literal, or an operator whose operands are all constant.
+func isConstant(expr model.Expression) bool {
+	switch expr := expr.(type) {
+	case *model.LiteralValueExpression:
+		return true
+	case *model.TemplateExpression:
+		_, ok := staticString(expr)
+		return ok
+	case *model.BinaryOpExpression:
+		return isConstant(expr.LeftOperand) && isConstant(expr.RightOperand)
+	case *model.UnaryOpExpression:
+		return isConstant(expr.Operand)
+	}
+	return false
+}
+
+// transformValue transforms the value of a resource attribute, output, or local variable. Unlike optional expressions,
+// which are emitted as null when absent, a missing value is emitted as a NullExpression and reported as an error.
+// Values are only missing from programs that were not fully bound.
+func (g *generator) transformValue(name string, subject hclsyntax.Node, expr model.Expression) map[string]interface{} {
+	if expr == nil {
+		g.diagnostics = append(g.diagnostics, missingValue(name, subject))
+		return map[string]interface{}{"type": "NullExpression"}
+	}
+	return g.transformExpression(expr)
+}
+
+// transformExpression transforms a single expression, recording its source range and text if they are enabled.
+func (g *generator) transformExpression(expr model.Expression) map[string]interface{} {
+	result := g.transformExpressionValue(expr)
+	if result != nil {
+		g.recordSource(result, expr.SyntaxNode())
+	}
+	return result
+}
+
+func (g *generator) transformExpressionValue(expr model.Expression) map[string]interface{} {
+	if g.options.FoldConstants {
+		if folded, ok := g.foldConstants(expr); ok {
+			return folded
+		}
+	}
+
+	switch expr := expr.(type) {
+	case *model.LiteralValueExpression:
+		if expr.Value.IsNull() {
+			return map[string]interface{}{
+				"type":   "LiteralValueExpression",
+				"value":  nil,
+				"isNull": true,
+			}
+		}
+
+		if !ctyTypeSupported(expr.Value.Type()) {
+			// Literals of unsupported types cannot be formatted either, so only the type of the value is recorded.
+			g.diagnostics = append(g.diagnostics, unsupportedExpressionType(expr))
+			return map[string]interface{}{
+				"type":      "UnsupportedExpression",
+				"exprType":  fmt.Sprintf("%T", expr),
+				"valueType": expr.Value.Type().FriendlyName(),
+			}
+		}
+
+		literal := map[string]interface{}{
+			"type":  "LiteralValueExpression",
+			"value": ctyToJSON(expr.Value, g.options.NumberMode),
+		}
+		// Numbers emitted as strings are marked so that consumers can tell them apart from string literals.
+		if g.options.NumberMode == NumberString && expr.Value.Type() == cty.Number {
+			literal["numberMode"] = "string"
+		}
+		return literal
+	case *model.TemplateExpression:
+		// Literal text parts carry a "literalText" field so that consumers can tell them apart from
+		// interpolations without inspecting each part.
+		parts := make([]interface{}, 0, len(expr.Parts))
+		for _, part := range expr.Parts {
+			transformed := g.transformExpression(part)
+			if literal, ok := part.(*model.LiteralValueExpression); ok {
+				if text, ok := staticString(literal); ok {
+					transformed["literalText"] = text
+				}
+			}
+			parts = append(parts, transformed)
+		}
+		return map[string]interface{}{
+			"type":  "TemplateExpression",
+			"parts": parts,
+		}
+	case *model.TemplateJoinExpression:
+		return map[string]interface{}{
+			"type":  "TemplateJoinExpression",
+			"tuple": g.transformExpression(expr.Tuple),
+		}
+	case *model.IndexExpression:
+		index := map[string]interface{}{
+			"type":       "IndexExpression",
+			"collection": g.transformExpression(expr.Collection),
+			"key":        g.transformExpression(expr.Key),
+		}
+		if key, ok := constantKey(expr.Key); ok {
+			index["constantKey"] = key
+		}
+		return index
+	case *model.ObjectConsExpression:
+		// Properties are emitted as a list of key/value entries in source order so that computed keys can be
+		// represented alongside literal ones.
+		properties := make([]interface{}, 0, len(expr.Items))
+		for _, item := range expr.Items {
+			property := map[string]interface{}{
+				"key":   g.transformExpression(item.Key),
+				"value": g.transformExpression(item.Value),
+			}
+			if propertyType := objectPropertyType(expr.Type(), item.Key); propertyType != nil {
+				property["type"] = transformValueType(propertyType, item.Value)
+			}
+			if token, ok := g.keyEnumType(item.Key); ok {
+				property["keyEnumType"] = token
+			}
+			properties = append(properties, property)
+		}
+		return map[string]interface{}{
+			"type":       "ObjectConsExpression",
+			"objectKind": g.objectKind(expr),
+			"properties": properties,
+		}
+	case *model.TupleConsExpression:
+		items := make([]interface{}, 0, len(expr.Expressions))
+		for _, item := range expr.Expressions {
+			items = append(items, g.transformExpression(item))
+		}
+		tuple := map[string]interface{}{
+			"type":  "TupleConsExpression",
+			"items": items,
+		}
+		// As with object properties, the types of nested constructors are shallow to keep the output linear in the
+		// depth.
+		switch t := expr.Type().(type) {
+		case *model.ListType:
+			if containsConsExpression(expr.Expressions) {
+				tuple["elementType"] = shallowType(t.ElementType)
+			} else {
+				tuple["elementType"] = transformType(t.ElementType)
+			}
+		case *model.TupleType:
+			if elementType, ok := uniformElementType(t); ok && containsConsExpression(expr.Expressions) {
+				tuple["elementType"] = shallowType(elementType)
+			} else if ok {
+				tuple["elementType"] = transformType(elementType)
+			} else if len(t.ElementTypes) == len(expr.Expressions) && len(t.ElementTypes) != 0 {
+				elementTypes := make([]interface{}, len(t.ElementTypes))
+				for i, elementType := range t.ElementTypes {
+					elementTypes[i] = transformValueType(elementType, expr.Expressions[i])
+				}
+				tuple["elementTypes"] = elementTypes
+			}
+		}
+		return tuple
+	case *model.FunctionCallExpression:
+		if function, ok := assetFunctions[expr.Name]; ok && len(expr.Args) == 1 {
+			return g.transformAsset(function, expr.Args[0])
+		}
+		switch expr.Name {
+		case pcl.Invoke:
+			if invoke, ok := g.transformInvoke(expr); ok {
+				return invoke
+			}
+		case notImplemented:
+			if len(expr.Args) == 1 {
+				if message, ok := staticString(expr.Args[0]); ok {
+					return map[string]interface{}{
+						"type":    "NotImplemented",
+						"message": message,
+					}
+				}
+			}
+		}
+		args := make([]interface{}, 0, len(expr.Args))
+		for i, arg := range expr.Args {
+			transformed := g.transformExpression(arg)
+			if g.options.NamedArguments {
+				transformed = map[string]interface{}{
+					"type":  "NamedArgument",
+					"name":  argumentName(expr.Signature, i),
+					"value": transformed,
+				}
+			}
+			args = append(args, transformed)
+		}
+		name := expr.Name
+		if g.options.FunctionNameMapper != nil {
+			name = g.options.FunctionNameMapper(name)
+		}
+		// "argCount" lets consumers branch on the arity of a call without inspecting its arguments. "args" is always
+		// an array, even for calls without arguments, unless OmitEmpty is set.
+		call := map[string]interface{}{
+			"type":     "FunctionCallExpression",
+			"name":     name,
+			"args":     args,
+			"argCount": len(args),
+		}
+		if g.options.OmitEmpty && len(args) == 0 {
+			delete(call, "args")
+		}
+		if collectionHelpers[expr.Name] {
+			call["helperKind"] = expr.Name
+		}
+		if expr.Signature.ReturnType != nil {
+			call["returnType"] = transformType(expr.Signature.ReturnType)
+			parameterTypes := make([]interface{}, len(expr.Signature.Parameters))
+			for i, parameter := range expr.Signature.Parameters {
+				parameterTypes[i] = transformType(parameter.Type)
+			}
+			call["parameterTypes"] = parameterTypes
+		}
+		return call
+	case *model.RelativeTraversalExpression:
+		return map[string]interface{}{
+			"type":      "RelativeTraversalExpression",
+			"source":    g.transformExpression(expr.Source),
+			"traversal": transformTraversal(expr.Traversal),
+		}
+	case *model.ScopeTraversalExpression:
+		if g.options.InlineLocals {
+			if local, ok := expr.Parts[0].(*pcl.LocalVariable); ok {
+				if inlined, ok := g.inlineLocal(expr, local); ok {
+					return inlined
+				}
+			}
+		}
+		return map[string]interface{}{
+			"type":      "ScopeTraversalExpression",
+			"rootName":  expr.RootName,
+			"rootKind":  traversalRootKind(expr),
+			"traversal": transformTraversal(expr.Traversal),
+		}
+	case *model.BinaryOpExpression:
+		return map[string]interface{}{
+			"type":      "BinaryOpExpression",
+			"operation": binaryOperationName(expr.Operation),
+			"left":      g.transformExpression(expr.LeftOperand),
+			"right":     g.transformExpression(expr.RightOperand),
+		}
+	case *model.UnaryOpExpression:
+		return map[string]interface{}{
+			"type":      "UnaryOpExpression",
+			"operation": unaryOperationName(expr.Operation),
+			"operand":   g.transformExpression(expr.Operand),
+		}
+	case *model.ConditionalExpression:
+		return map[string]interface{}{
+			"type":        "ConditionalExpression",
+			"condition":   g.transformExpression(expr.Condition),
+			"trueResult":  g.transformExpression(expr.TrueResult),
+			"falseResult": g.transformExpression(expr.FalseResult),
+			// The result type is often a union of the types of the two results. It is named "resultType" because
+			// "type" holds the expression's discriminator.
+			"resultType": transformType(expr.Type()),
+		}
+	case *model.ForExpression:
+		var keyVariable interface{}
+		if expr.KeyVariable != nil {
+			keyVariable = expr.KeyVariable.Name
+		}
+		return map[string]interface{}{
+			"type":          "ForExpression",
+			"keyVariable":   keyVariable,
+			"valueVariable": expr.ValueVariable.Name,
+			"collection":    g.transformExpression(expr.Collection),
+			"key":           g.transformExpression(expr.Key),
+			"value":         g.transformExpression(expr.Value),
+			"condition":     g.transformExpression(expr.Condition),
+			"group":         expr.Group,
+		}
+	case *model.SplatExpression:
+		return map[string]interface{}{
+			"type":   "SplatExpression",
+			"source": g.transformExpression(expr.Source),
+			"each":   g.transformExpression(expr.Each),
+			"item": map[string]interface{}{
+				"type": "SplatVariable",
+				"name": expr.Item.Name,
+			},
+		}
+	case *model.AnonymousFunctionExpression:
+		parameters := make([]interface{}, 0, len(expr.Signature.Parameters))
+		for _, parameter := range expr.Signature.Parameters {
+			parameters = append(parameters, map[string]interface{}{
+				"name": parameter.Name,
+			})
+		}
+		return map[string]interface{}{
+			"type":       "AnonymousFunctionExpression",
+			"parameters": parameters,
+			"body":       g.transformExpression(expr.Body),
+		}
+	case nil:
+		return nil
+	default:
+		if transform, ok := lookupExpressionTransformer(reflect.TypeOf(expr)); ok {
+			return transform(expr)
+		}
+		g.diagnostics = append(g.diagnostics, unsupportedExpressionType(expr))
+		return unsupportedExpression(expr)
+	}
+}
+
+var (
+	expressionTransformersLock sync.RWMutex
+	expressionTransformers     = map[reflect.Type]func(model.Expression) map[string]interface{}{}
+)
+
+// RegisterExpressionTransformer registers a function that transforms expressions of the given dynamic type, e.g.
+// reflect.TypeOf(&MyExpression{}). Registered transformers are only consulted for expression types that the generator
+// does not otherwise support, and replace any transformer previously registered for the same type. The result of the
+// transformer is emitted as-is, and should include a "type" field.
+func RegisterExpressionTransformer(matchType reflect.Type, transform func(model.Expression) map[string]interface{}) {
+	expressionTransformersLock.Lock()
+	defer expressionTransformersLock.Unlock()
+
+	expressionTransformers[matchType] = transform
+}
+
+func lookupExpressionTransformer(t reflect.Type) (func(model.Expression) map[string]interface{}, bool) {
+	expressionTransformersLock.RLock()
+	defer expressionTransformersLock.RUnlock()
+
+	transform, ok := expressionTransformers[t]
+	return transform, ok
+}
+
+// inlineLocal transforms a scope traversal rooted at a local variable into the local's definition. Any traversal
+// beyond the root is applied to the definition using a RelativeTraversalExpression. It returns false if the local is
+// already being inlined, in which case the reference is left as-is.
+func (g *generator) inlineLocal(
+	expr *model.ScopeTraversalExpression, local *pcl.LocalVariable) (map[string]interface{}, bool) {
+
+	if g.inlining[local] {
+		g.diagnostics = append(g.diagnostics, localVariableCycle(expr, local))
+		return nil, false
+	}
+
+	if g.inlining == nil {
+		g.inlining = map[*pcl.LocalVariable]bool{}
+	}
+	g.inlining[local] = true
+	defer delete(g.inlining, local)
+
+	value := g.transformExpression(local.Definition.Value)
+	if len(expr.Traversal) <= 1 {
+		return value, true
+	}
+	return map[string]interface{}{
+		"type":      "RelativeTraversalExpression",
+		"source":    value,
+		"traversal": transformTraversal(expr.Traversal[1:]),
+	}, true
+}
+
+// unsupportedExpression marks an expression as skipped rather than dropping it so that consumers can tell that the
+// output is incomplete.
+func unsupportedExpression(expr model.Expression) map[string]interface{} {
+	return map[string]interface{}{
+		"type":     "UnsupportedExpression",
+		"exprType": fmt.Sprintf("%T", expr),
+		"tokens":   fmt.Sprintf("%v", expr),
+	}
+}
+
+// transformInvoke transforms a call to the invoke intrinsic into an Invoke expression whose arguments are keyed by
+// name. It returns false if the token or the arguments are not statically known, in which case the call should be
+// serialized as an ordinary function call.
+func (g *generator) transformInvoke(expr *model.FunctionCallExpression) (map[string]interface{}, bool) {
+	if len(expr.Args) == 0 {
+		return nil, false
+	}
+	token, ok := staticString(expr.Args[0])
+	if !ok {
+		return nil, false
+	}
+
+	args := map[string]interface{}{}
+	if len(expr.Args) > 1 {
+		object, ok := expr.Args[1].(*model.ObjectConsExpression)
+		if !ok {
+			return nil, false
+		}
+		for _, item := range object.Items {
+			name, ok := staticString(item.Key)
+			if !ok {
+				return nil, false
+			}
+			args[name] = g.transformExpression(item.Value)
+		}
+	}
+
+	var options map[string]interface{}
+	if len(expr.Args) > 2 {
+		options = g.transformExpression(expr.Args[2])
+	}
+
+	invoke := map[string]interface{}{
+		"type":    "Invoke",
+		"token":   token,
+		"args":    args,
+		"options": options,
+	}
+	if g.options.OmitEmpty && len(args) == 0 {
+		delete(invoke, "args")
+	}
+	if expr.Signature.ReturnType != nil {
+		invoke["returnType"] = transformType(expr.Signature.ReturnType)
+	}
+	return invoke, true
+}
+
+// transformAsset transforms a call to a builtin function that constructs an asset or an archive. The argument is
+// emitted as an expression, and its value is also extracted into "path" if it is a literal. The argument of a remote
+// asset or archive is its URI, and the argument of a string asset is its text, which is extracted into "text" instead.
+func (g *generator) transformAsset(function assetFunction, arg model.Expression) map[string]interface{} {
+	field := "path"
+	if function.kind == "string" {
+		field = "text"
+	}
+	var value interface{}
+	if s, ok := staticString(arg); ok {
+		value = s
+	}
+	return map[string]interface{}{
+		"type":     function.typ,
+		"kind":     function.kind,
+		field:      value,
+		"argument": g.transformExpression(arg),
+	}
+}
+
+// staticString returns the value of an expression that is a string literal or a template with a single literal part.
+func staticString(expr model.Expression) (string, bool) {
+	switch expr := expr.(type) {
+	case *model.LiteralValueExpression:
+		if expr.Value.Type() == cty.String && expr.Value.IsKnown() && !expr.Value.IsNull() {
+			return expr.Value.AsString(), true
+		}
+	case *model.TemplateExpression:
+		if len(expr.Parts) == 1 {
+			return staticString(expr.Parts[0])
+		}
+	}
+	return "", false
+}
+
+// transformExpressionList transforms an expression that is expected to be a list. Tuples are emitted as an array of
+// their elements; any other expression is emitted as a single-element array. Absent expressions produce nil.
+func (g *generator) transformExpressionList(expr model.Expression) []interface{} {
+	switch expr := expr.(type) {
+	case nil:
+		return nil
+	case *model.TupleConsExpression:
+		items := make([]interface{}, 0, len(expr.Expressions))
+		for _, item := range expr.Expressions {
+			items = append(items, g.transformExpression(item))
+		}
+		return items
+	default:
+		return []interface{}{g.transformExpression(expr)}
+	}
+}
+
+// transformDependsOn transforms the dependsOn option of a resource. If the ResolveDependsOn option is set, each entry
+// that refers to a node is replaced by a NodeReference that holds the node's id. Other entries are transformed as
+// expressions.
+func (g *generator) transformDependsOn(expr model.Expression) []interface{} {
+	if !g.options.ResolveDependsOn {
+		return g.transformExpressionList(expr)
+	}
+
+	entries := []model.Expression{expr}
+	switch expr := expr.(type) {
+	case nil:
+		return nil
+	case *model.TupleConsExpression:
+		entries = expr.Expressions
+	}
+
+	dependencies := make([]interface{}, 0, len(entries))
+	for _, entry := range entries {
+		// Only bare references are resolved; traversals into a node, e.g. a[0], select a specific value.
+		if traversal, ok := entry.(*model.ScopeTraversalExpression); ok && len(traversal.Traversal) == 1 {
+			if node, ok := traversal.Parts[0].(pcl.Node); ok && nodeKind(node) != "" {
+				dependencies = append(dependencies, map[string]interface{}{
+					"type": "NodeReference",
+					"id":   nodeID(node),
+				})
+				continue
+			}
+		}
+		g.diagnostics = append(g.diagnostics, unresolvedDependency(entry))
+		dependencies = append(dependencies, g.transformExpression(entry))
+	}
+	return dependencies
+}
+
+func (g *generator) transformResourceOptions(options *pcl.ResourceOptions) map[string]interface{} {
+	if options == nil {
+		return nil
+	}
+
+	var resourceRange map[string]interface{}
+	if options.Range != nil {
+		// A numeric range replicates the resource a fixed number of times; any other range iterates a collection.
+		isCount := model.InputType(model.NumberType).ConversionFrom(options.Range.Type()) != model.NoConversion
+		resourceRange = map[string]interface{}{
+			"expression": g.transformExpression(options.Range),
+			"isCount":    isCount,
+		}
+	}
+
+	return map[string]interface{}{
+		"range":             resourceRange,
+		"protect":           g.transformExpression(options.Protect),
+		"dependsOn":         g.transformDependsOn(options.DependsOn),
+		"provider":          g.transformExpression(options.Provider),
+		"parent":            g.transformExpression(options.Parent),
+		"ignoreChanges":     g.transformExpressionList(options.IgnoreChanges),
+		"version":           g.transformExpression(options.Version),
+		"pluginDownloadURL": g.transformExpression(options.PluginDownloadURL),
+		"aliases":           nil,
+	}
+}
+
+// resourceAliases returns the value of the aliases option of a resource, if any. The binder does not support aliases
+// and reports an error for them, so they are not recorded in the resource's options, but the bound value is kept in the
+// options block of the resource's definition.
+//
+// TODO: read aliases from the resource's options once the binder supports them. Until then, aliases only reach the
+// output for callers that serialize programs despite bind errors, and each one is reported by a warning.
+func resourceAliases(resource *pcl.Resource) model.Expression {
+	if resource.Definition == nil {
+		return nil
+	}
+	for _, item := range resource.Definition.Body.Items {
+		if block, ok := item.(*model.Block); ok && block.Type == "options" {
+			if attr, ok := block.Body.Attribute("aliases"); ok {
+				return attr.Value
+			}
+		}
+	}
+	return nil
+}
+
+// aliasFields lists the fields of a structured resource alias.
+var aliasFields = map[string]bool{"name": true, "type": true, "parent": true, "stack": true, "project": true}
+
+// transformAliases transforms the aliases option of a resource. Aliases that are object constructors are emitted as
+// objects that hold the value of each of their fields. Other aliases, such as URNs, are emitted as objects whose
+// "value" field holds the alias.
+func (g *generator) transformAliases(expr model.Expression) []interface{} {
+	entries := []model.Expression{expr}
+	switch expr := expr.(type) {
+	case nil:
+		return nil
+	case *model.TupleConsExpression:
+		entries = expr.Expressions
+	}
+
+	aliases := make([]interface{}, 0, len(entries))
+	for _, entry := range entries {
+		object, ok := entry.(*model.ObjectConsExpression)
+		if !ok {
+			aliases = append(aliases, map[string]interface{}{"value": g.transformExpression(entry)})
+			continue
+		}
+
+		alias := map[string]interface{}{}
+		for _, item := range object.Items {
+			field, ok := staticString(item.Key)
+			if !ok || !aliasFields[field] {
+				g.diagnostics = append(g.diagnostics, unsupportedAliasField(item.Key))
+				continue
+			}
+			alias[field] = g.transformExpression(item.Value)
+		}
+		aliases = append(aliases, alias)
+	}
+	return aliases
+}
+
+// transformType transforms a model type into a normalized tree keyed by "kind". Element and property types are
+// transformed recursively.
+func transformType(t model.Type) map[string]interface{} {
+	switch t := t.(type) {
+	case nil:
+		return nil
+	case *model.ListType:
+		return map[string]interface{}{"kind": "list", "elementType": transformType(t.ElementType)}
+	case *model.SetType:
+		return map[string]interface{}{"kind": "set", "elementType": transformType(t.ElementType)}
+	case *model.MapType:
+		return map[string]interface{}{"kind": "map", "elementType": transformType(t.ElementType)}
+	case *model.OutputType:
+		return map[string]interface{}{"kind": "output", "elementType": transformType(t.ElementType)}
+	case *model.PromiseType:
+		return map[string]interface{}{"kind": "promise", "elementType": transformType(t.ElementType)}
+	case *model.TupleType:
+		return map[string]interface{}{"kind": "tuple", "elementTypes": transformTypes(t.ElementTypes)}
+	case *model.UnionType:
+		return map[string]interface{}{"kind": "union", "elementTypes": transformTypes(t.ElementTypes)}
+	case *model.ObjectType:
+		properties := make(map[string]interface{}, len(t.Properties))
+		for name, property := range t.Properties {
+			properties[name] = transformType(property)
+		}
+		return map[string]interface{}{"kind": "object", "properties": properties}
+	case *model.EnumType:
+		return map[string]interface{}{"kind": "enum", "token": t.Token, "elementType": transformType(t.Type)}
+	case *model.ConstType:
+		return transformType(t.Type)
+	}
+
+	switch t {
+	case model.BoolType:
+		return map[string]interface{}{"kind": "bool"}
+	case model.IntType:
+		return map[string]interface{}{"kind": "int"}
+	case model.NumberType:
+		return map[string]interface{}{"kind": "number"}
+	case model.StringType:
+		return map[string]interface{}{"kind": "string"}
+	case model.DynamicType:
+		return map[string]interface{}{"kind": "dynamic"}
+	case model.NoneType:
+		return map[string]interface{}{"kind": "none"}
+	}
+	if opaque, ok := t.(*model.OpaqueType); ok {
+		return map[string]interface{}{"kind": "opaque", "name": string(*opaque)}
+	}
+	return map[string]interface{}{"kind": "unknown", "name": t.String()}
+}
+
+// shallowType transforms only the outermost level of a model type: element and property types are omitted.
+func shallowType(t model.Type) map[string]interface{} {
+	switch t := t.(type) {
+	case *model.ListType:
+		return map[string]interface{}{"kind": "list"}
+	case *model.SetType:
+		return map[string]interface{}{"kind": "set"}
+	case *model.MapType:
+		return map[string]interface{}{"kind": "map"}
+	case *model.OutputType:
+		return map[string]interface{}{"kind": "output"}
+	case *model.PromiseType:
+		return map[string]interface{}{"kind": "promise"}
+	case *model.TupleType:
+		return map[string]interface{}{"kind": "tuple"}
+	case *model.UnionType:
+		return map[string]interface{}{"kind": "union"}
+	case *model.ObjectType:
+		return map[string]interface{}{"kind": "object"}
+	case *model.ConstType:
+		return shallowType(t.Type)
+	}
+	return transformType(t)
+}
+
+// transformValueType transforms the type of the given value. The types of object and tuple constructors are shallow:
+// the constructors carry the types of their own entries, and repeating the full nested type at every level would make
+// the output quadratic in the depth of the expression.
+func transformValueType(t model.Type, value model.Expression) map[string]interface{} {
+	if isConsExpression(value) {
+		return shallowType(t)
+	}
+	return transformType(t)
+}
+
+// objectPropertyType returns the type of the property with the given key within an object type. It returns nil if
+// the type is not an object type (e.g. because the object has computed keys) or the key is not static.
+func objectPropertyType(t model.Type, key model.Expression) model.Type {
+	if object, ok := t.(*model.ObjectType); ok {
+		if name, ok := staticString(key); ok {
+			return object.Properties[name]
+		}
+	}
+	return nil
+}
+
+// constantKey returns the value of an index key that is a literal number or string.
+func constantKey(key model.Expression) (interface{}, bool) {
+	if literal, ok := key.(*model.LiteralValueExpression); ok && literal.Value.Type() == cty.Number &&
+		literal.Value.IsKnown() && !literal.Value.IsNull() {
+		return transformNumber(literal.Value), true
+	}
+	if s, ok := staticString(key); ok {
+		return s, true
+	}
+	return nil, false
+}
+
+// argumentName returns the name of the signature parameter that receives the argument at the given position. Arguments
+// that do not correspond to a named parameter are named by their position.
+func argumentName(signature model.StaticFunctionSignature, position int) string {
+	var parameter *model.Parameter
+	switch {
+	case position < len(signature.Parameters):
+		parameter = &signature.Parameters[position]
+	case signature.VarargsParameter != nil:
+		parameter = signature.VarargsParameter
+	}
+	if parameter != nil && parameter.Name != "" {
+		return parameter.Name
+	}
+	return strconv.Itoa(position)
+}
+
+// containsConsExpression returns true if any of the given expressions is an object or tuple constructor.
+func containsConsExpression(exprs []model.Expression) bool {
+	for _, expr := range exprs {
+		if isConsExpression(expr) {
+			return true
+		}
+	}
+	return false
+}
+
+// uniformElementType returns the type shared by every element of a non-empty tuple type.
+func uniformElementType(t *model.TupleType) (model.Type, bool) {
+	if len(t.ElementTypes) == 0 {
+		return nil, false
+	}
+	for _, elementType := range t.ElementTypes[1:] {
+		if !elementType.Equals(t.ElementTypes[0]) {
+			return nil, false
+		}
+	}
+	return t.ElementTypes[0], true
+}
+
+// isConsExpression returns true if the given expression is an object or tuple constructor.
+func isConsExpression(expr model.Expression) bool {
+	switch expr.(type) {
+	case *model.ObjectConsExpression, *model.TupleConsExpression:
+		return true
+	default:
+		return false
+	}
+}
+
+// transformTypes transforms a list of model types.
+func transformTypes(types []model.Type) []interface{} {
+	result := make([]interface{}, len(types))
+	for i, t := range types {
+		result[i] = transformType(t)
+	}
+	return result
+}
+
+// schemaTypeName returns the name of the kind of the given schema type. Input and optional wrappers are ignored.
+func schemaTypeName(t schema.Type) string {
+	switch t := t.(type) {
+	case *schema.InputType:
+		return schemaTypeName(t.ElementType)
+	case *schema.OptionalType:
+		return schemaTypeName(t.ElementType)
+	case *schema.TokenType:
+		if t.UnderlyingType != nil {
+			return schemaTypeName(t.UnderlyingType)
+		}
+		return "token"
+	case *schema.ArrayType:
+		return "array"
+	case *schema.MapType:
+		return "map"
+	case *schema.ObjectType:
+		return "object"
+	case *schema.EnumType:
+		return "enum"
+	case *schema.UnionType:
+		return "union"
+	case *schema.ResourceType:
+		return "resource"
+	}
+
+	switch t {
+	case schema.BoolType:
+		return "boolean"
+	case schema.IntType:
+		return "integer"
+	case schema.NumberType:
+		return "number"
+	case schema.StringType:
+		return "string"
+	case schema.ArchiveType:
+		return "archive"
+	case schema.AssetType:
+		return "asset"
+	case schema.JSONType:
+		return "json"
+	default:
+		return "any"
+	}
+}
+
+// isSecretCall returns true if the given expression is a call to the secret intrinsic.
+func isSecretCall(expr model.Expression) bool {
+	call, ok := expr.(*model.FunctionCallExpression)
+	return ok && call.Name == "secret"
+}
+
+func (g *generator) transformResource(resource *pcl.Resource) map[string]interface{} {
+	inputProperties := map[string]*schema.Property{}
+	if resource.Schema != nil {
+		for _, property := range resource.Schema.InputProperties {
+			inputProperties[property.Name] = property
+		}
+	}
+
+	// resource.Inputs only holds the attributes of the resource body. The options block is bound separately into
+	// resource.Options and serialized under "options", so an input that happens to be named "options" is kept
+	// distinct from the block.
+	// The attributes are keyed by name, so their source order is recorded separately in "attributeOrder".
+	attributes := map[string]interface{}{}
+	attributeOrder := make([]interface{}, 0, len(resource.Inputs))
+	for _, attr := range resource.Inputs {
+		var schemaType interface{}
+		secret := isSecretCall(attr.Value)
+		if property, ok := inputProperties[attr.Name]; ok {
+			schemaType = schemaTypeName(property.Type)
+			secret = secret || property.Secret
+			g.recordObjectKinds(attr.Value, property.Type)
+		}
+		attribute := map[string]interface{}{
+			"value":      g.transformValue(resource.Name()+"."+attr.Name, attr.Syntax, attr.Value),
+			"schemaType": schemaType,
+		}
+		if secret {
+			attribute["secret"] = true
+		}
+		attributes[attr.Name] = attribute
+		attributeOrder = append(attributeOrder, attr.Name)
+	}
+
+	node := map[string]interface{}{
+		"type":           "Resource",
+		"name":           resource.Name(),
+		"token":          resource.Token,
+		"packageVersion": resourcePackageVersion(resource),
+		"isComponent":    resource.Schema != nil && resource.Schema.IsComponent,
+		"attributes":     attributes,
+		"attributeOrder": attributeOrder,
+		"options":        g.transformResourceOptions(resource.Options),
+	}
+	if options, ok := node["options"].(map[string]interface{}); ok && options != nil {
+		if aliases := resourceAliases(resource); aliases != nil {
+			g.diagnostics = append(g.diagnostics, unboundAliases(aliases))
+			options["aliases"] = g.transformAliases(aliases)
+		}
+	}
+	if g.options.IncludeTokenParts {
+		node["tokenParts"] = tokenParts(resource.Token)
+	}
+	if g.options.OmitEmpty && len(attributes) == 0 {
+		delete(node, "attributes")
+		delete(node, "attributeOrder")
+	}
+	return withLogicalName(node, resource.Name(), resource.LogicalName())
+}
+
+// tokenParts splits a "package:module:type" token into its parts. The parts of a malformed token are null. The type
+// is recorded as "typeName", as Walk treats "type" as the discriminator of a node.
+func tokenParts(token string) map[string]interface{} {
+	parts := map[string]interface{}{"package": nil, "module": nil, "typeName": nil}
+	components := strings.Split(token, ":")
+	if len(components) != 3 || components[0] == "" || components[2] == "" {
+		return parts
+	}
+	parts["package"], parts["module"], parts["typeName"] = components[0], components[1], components[2]
+	return parts
+}
+
+// recordObjectKinds records whether each object constructor within a resource input is assigned to a map or an object
+// type in the resource's schema, and the enum type of each object key that names an enum-typed property. Bound object
+// constructors always have an object type and keys are always strings, so both can only be recovered from the schema.
+func (g *generator) recordObjectKinds(expr model.Expression, t schema.Type) {
+	switch t := t.(type) {
+	case *schema.InputType:
+		g.recordObjectKinds(expr, t.ElementType)
+		return
+	case *schema.OptionalType:
+		g.recordObjectKinds(expr, t.ElementType)
+		return
+	}
+
+	switch expr := expr.(type) {
+	case *model.ObjectConsExpression:
+		if g.objectKinds == nil {
+			g.objectKinds = map[*model.ObjectConsExpression]string{}
+		}
+		switch t := t.(type) {
+		case *schema.MapType:
+			g.objectKinds[expr] = "map"
+			for _, item := range expr.Items {
+				g.recordObjectKinds(item.Value, t.ElementType)
+			}
+		case *schema.ObjectType:
+			g.objectKinds[expr] = "object"
+			for _, item := range expr.Items {
+				if name, ok := staticString(item.Key); ok {
+					if property, ok := t.Property(name); ok {
+						if token, ok := schemaEnumToken(property.Type); ok {
+							if g.keyEnumTypes == nil {
+								g.keyEnumTypes = map[model.Expression]string{}
+							}
+							g.keyEnumTypes[item.Key] = token
+						}
+						g.recordObjectKinds(item.Value, property.Type)
+					}
+				}
+			}
+		}
+	case *model.TupleConsExpression:
+		if array, ok := t.(*schema.ArrayType); ok {
+			for _, item := range expr.Expressions {
+				g.recordObjectKinds(item, array.ElementType)
+			}
+		}
+	case *model.FunctionCallExpression:
+		if expr.Name == pcl.IntrinsicConvert && len(expr.Args) > 0 {
+			g.recordObjectKinds(expr.Args[0], t)
+		}
+	}
+}
+
+// schemaEnumToken returns the token of the enum type that values of the given schema type may hold, if any.
+func schemaEnumToken(t schema.Type) (string, bool) {
+	switch t := t.(type) {
+	case *schema.InputType:
+		return schemaEnumToken(t.ElementType)
+	case *schema.OptionalType:
+		return schemaEnumToken(t.ElementType)
+	case *schema.EnumType:
+		return t.Token, true
+	case *schema.UnionType:
+		for _, element := range t.ElementTypes {
+			if token, ok := schemaEnumToken(element); ok {
+				return token, true
+			}
+		}
+	}
+	return "", false
+}
+
+// keyEnumType returns the token of the enum type of the given object key, if the key's bound type is an enum or the
+// key names an enum-typed property in the schema.
+func (g *generator) keyEnumType(key model.Expression) (string, bool) {
+	if enum, ok := key.Type().(*model.EnumType); ok {
+		return enum.Token, true
+	}
+	token, ok := g.keyEnumTypes[key]
+	return token, ok
+}
+
+// objectKind returns "map" if the given object constructor is assigned to a map type and "object" otherwise.
+func (g *generator) objectKind(expr *model.ObjectConsExpression) string {
+	if kind, ok := g.objectKinds[expr]; ok {
+		return kind
+	}
+	if _, ok := expr.Type().(*model.MapType); ok {
+		return "map"
+	}
+	return "object"
+}
+
+// resourcePackageVersion returns the version of the package that the resource's token was bound against, or nil if
+// the resource has no schema or the package is unversioned.
+func resourcePackageVersion(resource *pcl.Resource) interface{} {
+	if resource.Schema == nil || resource.Schema.PackageReference == nil {
+		return nil
+	}
+	if version := resource.Schema.PackageReference.Version(); version != nil {
+		return version.String()
+	}
+	return nil
+}
+
+// transformOutput transforms an output variable. Every output variable is exported as a stack output, so "exported" is
+// always true; it lets consumers tell outputs apart from local variables without knowing the node types.
+func (g *generator) transformOutput(output *pcl.OutputVariable) map[string]interface{} {
+	return withLogicalName(map[string]interface{}{
+		"type":       "OutputVariable",
+		"name":       output.Name(),
+		"outputType": transformType(output.Type()),
+		"secret":     isSecretOutput(output.Value),
+		"exported":   true,
+		"value":      g.transformValue(output.Name(), output.SyntaxNode(), output.Value),
+	}, output.Name(), output.LogicalName())
+}
+
+// isSecretOutput returns true if the value of an output is wrapped in a call to the secret intrinsic or refers
+// directly to a secret property of a resource.
+func isSecretOutput(value model.Expression) bool {
+	if isSecretCall(value) {
+		return true
+	}
+
+	traversal, ok := value.(*model.ScopeTraversalExpression)
+	if !ok || len(traversal.Traversal) < 2 {
+		return false
+	}
+	resource, ok := traversal.Parts[0].(*pcl.Resource)
+	if !ok || resource.Schema == nil {
+		return false
+	}
+	attr, ok := traversal.Traversal[1].(hcl.TraverseAttr)
+	if !ok {
+		return false
+	}
+	for _, property := range resource.Schema.Properties {
+		if property.Name == attr.Name {
+			return property.Secret
+		}
+	}
+	return false
+}
+
+func (g *generator) transformLocalVariable(variable *pcl.LocalVariable) map[string]interface{} {
+	return withLogicalName(map[string]interface{}{
+		"type":  "LocalVariable",
+		"name":  variable.Name(),
+		"value": g.transformValue(variable.Name(), variable.SyntaxNode(), variable.Definition.Value),
+	}, variable.Name(), variable.LogicalName())
+}
+
+func (g *generator) transformConfigVariable(variable *pcl.ConfigVariable) map[string]interface{} {
+	description := ""
+	if value, ok := staticAttributeValue(variable.Definition, "description"); ok && value.Type() == cty.String {
+		description = value.AsString()
+	}
+	nullable := false
+	if value, ok := staticAttributeValue(variable.Definition, "nullable"); ok && value.Type() == cty.Bool {
+		nullable = value.True()
+	}
+
+	result := map[string]interface{}{
+		"type":       "ConfigVariable",
+		"name":       variable.Name(),
+		"configType": transformType(variable.Type()),
+		// DefaultValue is nil when the config variable has no default, which serializes as null.
+		"defaultValue": g.transformExpression(variable.DefaultValue),
+		"description":  description,
+		"nullable":     nullable,
+	}
+	if values, ok := allowedValues(variable.Type()); ok {
+		result["allowedValues"] = values
+	}
+	return withLogicalName(result, variable.Name(), variable.LogicalName())
+}
+
+// allowedValues returns the values that a config variable of the given type may take if the type is an enum.
+//
+// TODO: config type labels cannot name enum types, so config variables bound from source never have an enum type and
+// "allowedValues" is never emitted by GenerateProgram. Emit it once the binder can give config variables enum types.
+func allowedValues(t model.Type) ([]interface{}, bool) {
+	enum, ok := t.(*model.EnumType)
+	if !ok {
+		return nil, false
+	}
+	values := make([]interface{}, 0, len(enum.Elements))
+	for _, element := range enum.Elements {
+		values = append(values, ctyToJSON(element, NumberNative))
+	}
+	return values, true
+}
+
+// withLogicalName adds a "logicalName" field to a node if its logical name differs from its name. A node without a
+// "logicalName" field has a logical name that is the same as its name.
+func withLogicalName(node map[string]interface{}, name, logicalName string) map[string]interface{} {
+	if logicalName != name {
+		node["logicalName"] = logicalName
+	}
+	return node
+}
+
+// staticAttributeValue evaluates the named attribute of a block without any variables in scope. It returns false if
+// the attribute is missing or does not evaluate to a known, non-null value.
+func staticAttributeValue(block *model.Block, name string) (cty.Value, bool) {
+	if block == nil {
+		return cty.NilVal, false
+	}
+	attr, ok := block.Body.Attribute(name)
+	if !ok {
+		return cty.NilVal, false
+	}
+	value, diags := attr.Value.Evaluate(&hcl.EvalContext{})
+	if diags.HasErrors() || !value.IsKnown() || value.IsNull() {
+		return cty.NilVal, false
+	}
+	return value, true
+}
+
+// transformNode transforms a single program node. Unsupported nodes produce a diagnostic and a nil result.
+func (g *generator) transformNode(node pcl.Node) map[string]interface{} {
+	if !g.includeNode(node) {
+		return nil
+	}
+
+	var result map[string]interface{}
+	switch n := node.(type) {
+	case *pcl.Resource:
+		result = g.transformResource(n)
+	case *pcl.OutputVariable:
+		result = g.transformOutput(n)
+	case *pcl.LocalVariable:
+		result = g.transformLocalVariable(n)
+	case *pcl.ConfigVariable:
+		result = g.transformConfigVariable(n)
+	default:
+		// TODO: serialize components once the binder produces them. pcl.Component is not yet a pcl.Node, so
+		// `component` blocks never appear in program.Nodes.
+		g.diagnostics = append(g.diagnostics, unsupportedNodeType(node))
+		return nil
+	}
+	result["id"] = nodeID(node)
+	result["safeName"] = SafeName(nodeLogicalName(node))
+	result["sourceIndex"] = g.sourceIndex(node)
+	result["sourceFile"] = syntaxRange(node.SyntaxNode()).Filename
+	g.recordSource(result, node.SyntaxNode())
+	return result
+}
+
+// sourceIndex returns the position of the given node in the order in which the program's nodes were declared. The
+// program's nodes are sorted by their dependencies, so the declaration order is recovered from their source ranges:
+// nodes are ordered by filename and then by offset. Nodes without a source range are ordered last.
+func (g *generator) sourceIndex(node pcl.Node) int {
+	if g.sourceIndices == nil {
+		nodes := make([]pcl.Node, len(g.program.Nodes))
+		copy(nodes, g.program.Nodes)
+		sort.SliceStable(nodes, func(i, j int) bool {
+			ri, rj := syntaxRange(nodes[i].SyntaxNode()), syntaxRange(nodes[j].SyntaxNode())
+			if (ri.Filename == "") != (rj.Filename == "") {
+				return rj.Filename == ""
+			}
+			if ri.Filename != rj.Filename {
+				return ri.Filename < rj.Filename
+			}
+			return ri.Start.Byte < rj.Start.Byte
+		})
+
+		g.sourceIndices = make(map[pcl.Node]int, len(nodes))
+		for i, n := range nodes {
+			g.sourceIndices[n] = i
+		}
+	}
+	return g.sourceIndices[node]
+}
+
+// nodeID returns the id that other tools use to refer to a node. Names may collide across kinds, so the id combines
+// the node's kind and logical name.
+func nodeID(node pcl.Node) string {
+	return nodeKind(node) + "::" + nodeLogicalName(node)
+}
+
+// nodeLogicalName returns the logical name of the given node.
+func nodeLogicalName(node pcl.Node) string {
+	switch n := node.(type) {
+	case *pcl.Resource:
+		return n.LogicalName()
+	case *pcl.OutputVariable:
+		return n.LogicalName()
+	case *pcl.LocalVariable:
+		return n.LogicalName()
+	case *pcl.ConfigVariable:
+		return n.LogicalName()
+	default:
+		return ""
+	}
+}
+
+// SafeName escapes a logical name so that it can be used as a filename or identifier. ASCII letters, digits, and
+// hyphens are kept, and every other byte is replaced with an underscore followed by the byte's value as two lowercase
+// hexadecimal digits, e.g. "my bucket/logs" becomes "my_20bucket_2flogs". Underscores are escaped too, so distinct
+// names always have distinct safe names. UnescapeSafeName reverses the escaping.
+func SafeName(name string) string {
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c == '-' || '0' <= c && c <= '9' || 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "_%02x", c)
+		}
+	}
+	return b.String()
+}
+
+// UnescapeSafeName returns the logical name that SafeName escaped into the given safe name.
+func UnescapeSafeName(safeName string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(safeName); i++ {
+		if safeName[i] != '_' {
+			b.WriteByte(safeName[i])
+			continue
+		}
+		if i+2 >= len(safeName) {
+			return "", fmt.Errorf("truncated escape at offset %d of %q", i, safeName)
+		}
+		c, err := strconv.ParseUint(safeName[i+1:i+3], 16, 8)
+		if err != nil {
+			return "", fmt.Errorf("invalid escape at offset %d of %q", i, safeName)
+		}
+		b.WriteByte(byte(c))
+		i += 2
+	}
+	return b.String(), nil
+}
+
+// includeNode returns true if the given node's kind is selected by the IncludeKinds option. All nodes are included
+// if the option is empty.
+func (g *generator) includeNode(node pcl.Node) bool {
+	if len(g.options.IncludeKinds) == 0 {
+		return true
+	}
+
+	kind := nodeKind(node)
+	for _, included := range g.options.IncludeKinds {
+		if included == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// traversalRootKind returns the kind of the node that the root of a scope traversal refers to, or "unknown" if the
+// root is not a node, e.g. a range or for-expression variable.
+func traversalRootKind(expr *model.ScopeTraversalExpression) string {
+	if len(expr.Parts) != 0 {
+		if node, ok := expr.Parts[0].(pcl.Node); ok {
+			if kind := nodeKind(node); kind != "" {
+				return kind
+			}
+		}
+	}
+	return "unknown"
+}
+
+// nodeKind returns the kind of a node as recorded in the "type" field of its transformed form, or the empty string if
+// the node cannot be transformed.
+func nodeKind(node pcl.Node) string {
+	switch node.(type) {
+	case *pcl.Resource:
+		return "Resource"
+	case *pcl.OutputVariable:
+		return "OutputVariable"
+	case *pcl.LocalVariable:
+		return "LocalVariable"
+	case *pcl.ConfigVariable:
+		return "ConfigVariable"
+	default:
+		return ""
+	}
+}
+
+// recordSource adds the source range and source text of the given syntax node to a transformed node or expression,
+// as selected by the IncludeRanges and IncludeSourceText options. Nothing is recorded if the syntax node has no known
+// position.
+func (g *generator) recordSource(result map[string]interface{}, node hclsyntax.Node) {
+	if !g.options.IncludeRanges && !g.options.IncludeSourceText {
+		return
+	}
+	rng := syntaxRange(node)
+	if rng == (hcl.Range{}) {
+		return
+	}
+	if g.options.IncludeRanges {
+		result["range"] = transformRange(rng)
+	}
+	if g.options.IncludeSourceText {
+		if text, ok := g.sourceText(rng); ok {
+			result["sourceText"] = text
+		}
+	}
+}
+
+// sourceText returns the text of the program's source files that lies within the given range.
+func (g *generator) sourceText(rng hcl.Range) (string, bool) {
+	if g.program == nil {
+		return "", false
+	}
+	if g.source == nil {
+		g.source = g.program.Source()
+	}
+	file, ok := g.source[rng.Filename]
+	if !ok || rng.Start.Byte < 0 || rng.Start.Byte > rng.End.Byte || rng.End.Byte > len(file) {
+		return "", false
+	}
+	return file[rng.Start.Byte:rng.End.Byte], true
+}
+
+// transformRange transforms a source range.
+func transformRange(rng hcl.Range) map[string]interface{} {
+	transformPos := func(pos hcl.Pos) map[string]interface{} {
+		return map[string]interface{}{
+			"line":   pos.Line,
+			"column": pos.Column,
+			"byte":   pos.Byte,
+		}
+	}
+	return map[string]interface{}{
+		"filename": rng.Filename,
+		"start":    transformPos(rng.Start),
+		"end":      transformPos(rng.End),
+	}
+}
+
+// packageLess orders packages by name and then by version. Packages without a version sort first.
+func packageLess(a, b *schema.Package) bool {
+	if a.Name != b.Name {
+		return a.Name < b.Name
+	}
+	if a.Version == nil || b.Version == nil {
+		return a.Version == nil && b.Version != nil
+	}
+	return a.Version.LT(*b.Version)
+}
+
+func (g *generator) transformPackages() []interface{} {
+	// Sort the packages explicitly so that the output does not depend on the order in which they were referenced.
+	// Missing descriptors are skipped rather than dereferenced.
+	programPackages := make([]*schema.Package, 0, len(g.program.Packages()))
+	for _, pkg := range g.program.Packages() {
+		if pkg != nil {
+			programPackages = append(programPackages, pkg)
+		}
+	}
+	sort.SliceStable(programPackages, func(i, j int) bool {
+		return packageLess(programPackages[i], programPackages[j])
+	})
+
+	packages := make([]interface{}, 0, len(programPackages))
+	for _, pkg := range programPackages {
+		packages = append(packages, transformPackage(pkg))
+	}
+	return packages
+}
+
+// CollectTokens returns the tokens of every resource and invoke referenced by the program, deduplicated and sorted.
+func CollectTokens(program *pcl.Program) []string {
+	seen := map[string]bool{}
+	for _, node := range program.Nodes {
+		if resource, ok := node.(*pcl.Resource); ok {
+			seen[resource.Token] = true
+		}
+		visitInvokeTokens(node, func(token string) {
+			seen[token] = true
+		})
+	}
+
+	tokens := make([]string, 0, len(seen))
+	for token := range seen {
+		tokens = append(tokens, token)
+	}
+	sort.Strings(tokens)
+	return tokens
+}
+
+// visitInvokeTokens calls visit with the token of each call to the invoke intrinsic within the given node.
+func visitInvokeTokens(node pcl.Node, visit func(token string)) {
+	node.VisitExpressions(nil, func(expr model.Expression) (model.Expression, hcl.Diagnostics) {
+		if call, ok := expr.(*model.FunctionCallExpression); ok && call.Name == pcl.Invoke && len(call.Args) > 0 {
+			if token, ok := staticString(call.Args[0]); ok {
+				visit(token)
+			}
+		}
+		return expr, nil
+	})
+}
+
+// transformSchemas transforms the schemas of the resources and invokes used by the program, keyed by the same tokens
+// as CollectTokens. Tokens without a schema are left out.
+func (g *generator) transformSchemas() map[string]interface{} {
+	schemas := map[string]interface{}{}
+	for _, node := range g.program.Nodes {
+		if resource, ok := node.(*pcl.Resource); ok && resource.Schema != nil {
+			schemas[resource.Token] = map[string]interface{}{
+				"kind":    "resource",
+				"inputs":  transformPropertySchemas(resource.Schema.InputProperties),
+				"outputs": transformPropertySchemas(resource.Schema.Properties),
+			}
+		}
+		visitInvokeTokens(node, func(token string) {
+			fn, ok := g.lookupFunction(token)
+			if !ok {
+				return
+			}
+			functionSchema := map[string]interface{}{
+				"kind":    "function",
+				"inputs":  map[string]interface{}{},
+				"outputs": map[string]interface{}{},
+			}
+			if fn.Inputs != nil {
+				functionSchema["inputs"] = transformPropertySchemas(fn.Inputs.Properties)
+			}
+			if fn.Outputs != nil {
+				functionSchema["outputs"] = transformPropertySchemas(fn.Outputs.Properties)
+			}
+			schemas[token] = functionSchema
+		})
+	}
+	return schemas
+}
+
+// lookupFunction returns the schema of the function with the given token from the program's packages. The binder
+// canonicalizes invoke tokens, so the token is compared against the canonical form of each function's token as well
+// as the token itself.
+func (g *generator) lookupFunction(token string) (*schema.Function, bool) {
+	for _, pkg := range g.program.Packages() {
+		if pkg == nil {
+			continue
+		}
+		for _, fn := range pkg.Functions {
+			if fn.Token == token || canonicalToken(pkg, fn.Token) == token {
+				return fn, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// canonicalToken returns the canonical form of a token within the given package, e.g. "aws::getAmi" for
+// "aws:index/getAmi:getAmi".
+func canonicalToken(pkg *schema.Package, token string) string {
+	member := token[strings.LastIndex(token, ":")+1:]
+	return pkg.Name + ":" + pkg.TokenToModule(token) + ":" + member
+}
+
+// transformPropertySchemas transforms the schemas of a list of properties into a map keyed by property name.
+func transformPropertySchemas(properties []*schema.Property) map[string]interface{} {
+	result := make(map[string]interface{}, len(properties))
+	for _, property := range properties {
+		// The key is not "type", which Walk treats as the discriminator of a node.
+		result[property.Name] = map[string]interface{}{
+			"schemaType":  schemaTypeName(property.Type),
+			"required":    property.IsRequired(),
+			"secret":      property.Secret,
+			"description": property.Comment,
+		}
+	}
+	return result
+}
+
+// transformPackage transforms the descriptor of a package referenced by the program.
+//
+// NOTE: schema.Package does not yet carry parameterization, so parameterized packages are emitted without it.
+func transformPackage(pkg *schema.Package) map[string]interface{} {
+	var version interface{}
+	if pkg.Version != nil {
+		version = pkg.Version.String()
+	}
+	// Programs only bind packages from resource provider schemas, so every package comes from a resource plugin.
+	return map[string]interface{}{
+		"name":        pkg.Name,
+		"kind":        string(workspace.ResourcePlugin),
+		"version":     version,
+		"downloadURL": pkg.PluginDownloadURL,
+	}
+}
+
+// transformProject transforms the metadata of the project that contains the program.
+func transformProject(project *workspace.Project) map[string]interface{} {
+	description := ""
+	if project.Description != nil {
+		description = *project.Description
+	}
+	return map[string]interface{}{
+		"name":        project.Name.String(),
+		"description": description,
+		"runtime":     project.Runtime.Name(),
+	}
+}
+
+func (g *generator) transformProgram() map[string]interface{} {
+	nodes := make([]interface{}, 0, len(g.program.Nodes))
+	var resources map[string]interface{}
+	if g.options.GroupByPackage {
+		resources = map[string]interface{}{}
+	}
+	for _, node := range g.program.Nodes {
+		nodeJSON := g.transformNode(node)
+		if nodeJSON == nil {
+			continue
+		}
+		if resource, ok := node.(*pcl.Resource); ok && resources != nil {
+			pkg, _, _, _ := pcl.DecomposeToken(resource.Token, hcl.Range{})
+			group, _ := resources[pkg].([]interface{})
+			resources[pkg] = append(group, nodeJSON)
+			continue
+		}
+		nodes = append(nodes, nodeJSON)
+	}
+
+	programJSON := map[string]interface{}{
+		"formatVersion": FormatVersion,
+		"nodes":         nodes,
+	}
+	if resources != nil {
+		programJSON["resources"] = resources
+	}
+	if !g.options.OmitPackages {
+		if packages := g.transformPackages(); len(packages) > 0 || !g.options.OmitEmpty {
+			programJSON["packages"] = packages
+		}
+	}
+	if g.options.Project != nil {
+		programJSON["project"] = transformProject(g.options.Project)
+	}
+	if g.options.IncludeTokens {
+		programJSON["tokens"] = CollectTokens(g.program)
+	}
+	if g.options.EmbedSchemas {
+		programJSON["schemas"] = g.transformSchemas()
+	}
+	return programJSON
+}
+
+// SplitMode controls how GenerateProgramWithOptions divides a program between files.
+type SplitMode int
+
+const (
+	// SplitNone emits the whole program into a single program.json file.
+	SplitNone SplitMode = iota
+	// SplitPerKind emits one file per kind of node (resources.json, outputs.json, locals.json, and config.json) and
+	// the referenced packages into packages.json. Every file records the format version.
+	SplitPerKind
+)
+
+// splitFilenames maps node types to the file that holds them when splitting per kind.
+var splitFilenames = map[string]string{
+	"Resource":       "resources.json",
+	"OutputVariable": "outputs.json",
+	"LocalVariable":  "locals.json",
+	"ConfigVariable": "config.json",
+}
+
+// Format selects the encoding of the files produced by GenerateProgramWithOptions.
+type Format int
+
+const (
+	// JSONDocument emits each file as a single JSON document.
+	JSONDocument Format = iota
+	// JSONLines emits a single program.jsonl file that holds each node followed by each package as a compact JSON
+	// object on its own line. Package lines have the type "Package". JSON Lines output cannot be split.
+	JSONLines
+)
+
+// GenerateProgramOptions controls how GenerateProgramWithOptions formats program.json.
+type GenerateProgramOptions struct {
+	// Indent is the string used for each level of indentation. Defaults to two spaces.
+	Indent string
+	// Compact disables indentation and emits the program without any insignificant whitespace.
+	Compact bool
+	// IncludeRanges records the source range of each node and expression in a "range" field.
+	IncludeRanges bool
+	// IncludeSourceText records the source text of each node and expression in a "sourceText" field.
+	IncludeSourceText bool
+	// Project, if set, is recorded in a top-level "project" field.
+	Project *workspace.Project
+	// SplitMode controls whether the program is split between multiple files. Defaults to a single file.
+	SplitMode SplitMode
+	// Format selects the encoding of the output. Defaults to a single JSON document per file.
+	Format Format
+	// InlineLocals replaces references to local variables with the local's definition.
+	InlineLocals bool
+	// ErrorOnEmpty reports an error diagnostic instead of generating any files if the program has no nodes.
+	ErrorOnEmpty bool
+	// NamedArguments emits each function call argument as a NamedArgument that records the name of the parameter
+	// that receives it.
+	NamedArguments bool
+	// FunctionNameMapper, if set, maps the name of each function call before it is emitted. Calls to the invoke
+	// and notImplemented intrinsics are recognized by their original names.
+	FunctionNameMapper func(string) string
+	// IncludeKinds, if non-empty, restricts the emitted nodes to those whose type is listed, e.g. "Resource" or
+	// "OutputVariable". Packages are emitted unless OmitPackages is set.
+	IncludeKinds []string
+	// GroupByPackage moves resources out of "nodes" into a top-level "resources" field that maps the name of each
+	// package to the package's resources. Other nodes stay in "nodes". Grouped output cannot be split or encoded as
+	// JSON Lines.
+	GroupByPackage bool
+	// OmitEmpty leaves out the "attributes" and "attributeOrder" fields of resources without inputs, the "args" field of
+	// function calls and invokes without arguments, and the "packages" field of programs that reference no packages.
+	OmitEmpty bool
+	// OmitPackages leaves out the "packages" field, for consumers that manage plugins separately.
+	OmitPackages bool
+	// EmbedSchemas records the input and output properties of every resource and invoke used by the program in a
+	// top-level "schemas" field, keyed by token. When splitting per kind, the schemas are recorded in packages.json.
+	// Schemas can be large, so they are left out by default.
+	EmbedSchemas bool
+	// IncludeTokens records the tokens of every resource and invoke used by the program in a top-level "tokens"
+	// field. When splitting per kind, the tokens are recorded in packages.json. JSON Lines output does not include
+	// them. See CollectTokens.
+	IncludeTokens bool
+	// IncludeTokenParts records the package, module and type of each resource's token in a "tokenParts" field.
+	IncludeTokenParts bool
+	// NumberMode selects how the values of number literals are emitted. Defaults to NumberNative.
+	NumberMode NumberMode
+	// FoldConstants replaces operators whose operands are all literals with the literal result, and conditionals
+	// with a literal condition with the selected result.
+	FoldConstants bool
+	// ResolveDependsOn emits each dependsOn entry of a resource that refers to another node as a NodeReference that
+	// holds the node's id rather than as an expression. Entries that cannot be resolved are emitted as expressions
+	// with a warning.
+	ResolveDependsOn bool
+}
+
+// GenerateProgram serializes the given program into a single program.json file.
+//
+// Config variables do not yet carry "allowedValues": the binder cannot give them enum types, so their allowed values
+// are unknown.
+func GenerateProgram(program *pcl.Program) (map[string][]byte, hcl.Diagnostics, error) {
+	return GenerateProgramWithOptions(program, GenerateProgramOptions{})
+}
+
+// GenerateProgramWithOptions serializes the given program into program.json, or into several files if a SplitMode
+// is set, using the given formatting options.
+func GenerateProgramWithOptions(
+	program *pcl.Program, opts GenerateProgramOptions) (map[string][]byte, hcl.Diagnostics, error) {
+
+	if opts.ErrorOnEmpty && len(program.Nodes) == 0 {
+		return nil, hcl.Diagnostics{emptyProgram()}, nil
+	}
+
+	if opts.GroupByPackage && (opts.SplitMode != SplitNone || opts.Format == JSONLines) {
+		return nil, nil, fmt.Errorf("grouped output cannot be split or encoded as JSON Lines")
+	}
+
+	if opts.Format == JSONLines {
+		if opts.SplitMode != SplitNone {
+			return nil, nil, fmt.Errorf("JSON Lines output cannot be split")
+		}
+		g := &generator{program: program, options: opts}
+		data, err := g.generateJSONLines()
+		if err != nil {
+			return nil, nil, err
+		}
+		return map[string][]byte{"program.jsonl": data}, g.diagnostics, nil
+	}
+
+	marshal := func(v interface{}) ([]byte, error) {
+		if opts.Compact {
+			return json.Marshal(v)
+		}
+		indent := opts.Indent
+		if indent == "" {
+			indent = "  "
+		}
+		return json.MarshalIndent(v, "", indent)
+	}
+
+	programJSON, diagnostics := BuildProgramTreeWithOptions(program, opts)
+
+	contents := map[string]interface{}{}
+	switch opts.SplitMode {
+	case SplitPerKind:
+		for _, filename := range splitFilenames {
+			contents[filename] = map[string]interface{}{
+				"formatVersion": FormatVersion,
+				"nodes":         []interface{}{},
+			}
+		}
+		for _, node := range programJSON["nodes"].([]interface{}) {
+			filename := splitFilenames[node.(map[string]interface{})["type"].(string)]
+			file := contents[filename].(map[string]interface{})
+			file["nodes"] = append(file["nodes"].([]interface{}), node)
+		}
+
+		packagesJSON := map[string]interface{}{
+			"formatVersion": FormatVersion,
+		}
+		if packages, ok := programJSON["packages"]; ok {
+			packagesJSON["packages"] = packages
+		}
+		if project, ok := programJSON["project"]; ok {
+			packagesJSON["project"] = project
+		}
+		if tokens, ok := programJSON["tokens"]; ok {
+			packagesJSON["tokens"] = tokens
+		}
+		if schemas, ok := programJSON["schemas"]; ok {
+			packagesJSON["schemas"] = schemas
+		}
+		contents["packages.json"] = packagesJSON
+	default:
+		contents["program.json"] = programJSON
+	}
+
+	files := map[string][]byte{}
+	for filename, content := range contents {
+		data, err := marshal(content)
+		if err != nil {
+			return nil, nil, err
+		}
+		files[filename] = data
+	}
+	return files, diagnostics, nil
+}
+
+// BuildProgramTree returns the tree that GenerateProgram serializes into program.json, for consumers that encode the
+// program in another format.
+func BuildProgramTree(program *pcl.Program) (map[string]interface{}, hcl.Diagnostics) {
+	return BuildProgramTreeWithOptions(program, GenerateProgramOptions{})
+}
+
+// BuildProgramTreeWithOptions is like BuildProgramTree, but applies the given options. Options that only affect the
+// encoding of the output, such as Indent, Compact, SplitMode, and Format, are ignored.
+func BuildProgramTreeWithOptions(
+	program *pcl.Program, opts GenerateProgramOptions) (map[string]interface{}, hcl.Diagnostics) {
+
+	g := &generator{program: program, options: opts}
+	programJSON := g.transformProgram()
+	return programJSON, g.diagnostics
+}
+
+// ProgramHash returns a hex-encoded SHA-256 hash of the tree that GenerateProgram serializes into program.json. The
+// tree is encoded with sorted object keys and without indentation, so the hash only changes when the content of the
+// program changes.
+func ProgramHash(program *pcl.Program) (string, error) {
+	tree, _ := BuildProgramTree(program)
+	data, err := json.Marshal(tree)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// generateJSONLines encodes each node and then each package of the program as a compact JSON object on its own line.
+func (g *generator) generateJSONLines() ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, node := range g.program.Nodes {
+		if nodeJSON := g.transformNode(node); nodeJSON != nil {
+			if err := encoder.Encode(nodeJSON); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if g.options.OmitPackages {
+		return buf.Bytes(), nil
+	}
+	for _, pkg := range g.transformPackages() {
+		pkg.(map[string]interface{})["type"] = "Package"
+		if err := encoder.Encode(pkg); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// GenerateYAML serializes the given program into a single program.yaml file. The YAML document has the same structure
+// as program.json, with object keys in sorted order.
+func GenerateYAML(program *pcl.Program) (map[string][]byte, hcl.Diagnostics, error) {
+	g := &generator{program: program}
+	data, err := encoding.YAML.Marshal(yamlValue(g.transformProgram()))
+	if err != nil {
+		return nil, nil, err
+	}
+	return map[string][]byte{"program.yaml": data}, g.diagnostics, nil
+}
+
+// yamlValue prepares a transformed value for YAML encoding. Integers are held as json.Number, which YAML would
+// otherwise encode as a string, so they are replaced with integer scalar nodes.
+func yamlValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if v == nil {
+			return nil
+		}
+		result := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			result[key] = yamlValue(value)
+		}
+		return result
+	case []interface{}:
+		if v == nil {
+			return nil
+		}
+		result := make([]interface{}, len(v))
+		for i, value := range v {
+			result[i] = yamlValue(value)
+		}
+		return result
+	case json.Number:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: v.String()}
+	default:
+		return v
+	}
+}
+
+// GenerateProgramStream serializes the given program as JSON directly into w. Unlike GenerateProgram, only a single
+// node is held in memory at a time, which keeps memory usage flat for very large programs.
+func GenerateProgramStream(program *pcl.Program, w io.Writer) (hcl.Diagnostics, error) {
+	g := &generator{program: program}
+	encoder := json.NewEncoder(w)
+
+	if _, err := fmt.Fprintf(w, `{"formatVersion":%q,"nodes":[`, FormatVersion); err != nil {
+		return nil, err
+	}
+	first := true
+	for _, node := range program.Nodes {
+		nodeJSON := g.transformNode(node)
+		if nodeJSON == nil {
+			continue
+		}
+		if !first {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return nil, err
+			}
+		}
+		first = false
+
+		if err := encoder.Encode(nodeJSON); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := io.WriteString(w, `],"packages":`); err != nil {
+		return nil, err
+	}
+	if err := encoder.Encode(g.transformPackages()); err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(w, "}\n"); err != nil {
+		return nil, err
+	}
+	return g.diagnostics, nil
+}
+
+// GenerateProjectOptions controls how GenerateProjectWithOptions writes a project.
+type GenerateProjectOptions struct {
+	// FileMode is the permission mode of the written files. Defaults to 0600.
+	FileMode os.FileMode
+	// Program holds the options used to serialize the program, e.g. to split it between several files. Its Project
+	// is replaced by the project being written.
+	Program GenerateProgramOptions
+}
+
+// GenerateProject serializes the given program and writes the resulting files into directory.
+func GenerateProject(directory string, project workspace.Project, program *pcl.Program) error {
+	return GenerateProjectWithOptions(directory, project, program, GenerateProjectOptions{})
+}
+
+// GenerateProjectWithOptions serializes the given program and writes the resulting files into directory using the
+// given options.
+func GenerateProjectWithOptions(
+	directory string, project workspace.Project, program *pcl.Program, opts GenerateProjectOptions) error {
+
+	return GenerateProjectContext(context.Background(), directory, project, program, opts)
+}
+
+// GenerateProjectContext is like GenerateProjectWithOptions, but stops writing files once ctx is done. Files that
+// were written before ctx was done are left in place.
+func GenerateProjectContext(ctx context.Context,
+	directory string, project workspace.Project, program *pcl.Program, opts GenerateProjectOptions) error {
+
+	fileMode := opts.FileMode
+	if fileMode == 0 {
+		fileMode = 0600
+	}
+
+	files, err := GenerateProjectPlanWithOptions(directory, project, program, opts)
+	if err != nil {
+		return err
+	}
+
+	if info, err := os.Stat(directory); err == nil && !info.IsDir() {
+		return fmt.Errorf("output path %q is not a directory", directory)
+	}
+	if err := os.MkdirAll(directory, 0700); err != nil {
+		return fmt.Errorf("could not create output directory: %w", err)
+	}
+
+	// Write the files in a stable order so that the files written before a cancellation are predictable.
+	outPaths := make([]string, 0, len(files))
+	for outPath := range files {
+		outPaths = append(outPaths, outPath)
+	}
+	sort.Strings(outPaths)
+
+	for _, outPath := range outPaths {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("could not write output program: %w", err)
+		}
+
+		err := os.WriteFile(outPath, files[outPath], fileMode)
+		if err != nil {
+			return fmt.Errorf("could not write output program: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// GenerateProjectPlan returns the files that GenerateProject would write into directory, keyed by their paths,
+// without writing anything.
+func GenerateProjectPlan(
+	directory string, project workspace.Project, program *pcl.Program) (map[string][]byte, error) {
+
+	return GenerateProjectPlanWithOptions(directory, project, program, GenerateProjectOptions{})
+}
+
+// GenerateProjectPlanWithOptions returns the files that GenerateProjectWithOptions would write into directory using
+// the given options, keyed by their paths, without writing anything.
+func GenerateProjectPlanWithOptions(directory string, project workspace.Project, program *pcl.Program,
+	opts GenerateProjectOptions) (map[string][]byte, error) {
+
+	// Set the runtime to "json" before generating so that the program records the same project as Pulumi.yaml.
+	project.Runtime = workspace.NewProjectRuntimeInfo("json", nil)
+
+	programOpts := opts.Program
+	programOpts.Project = &project
+	files, diagnostics, err := GenerateProgramWithOptions(program, programOpts)
+	if err != nil {
+		return nil, err
+	}
+	if diagnostics.HasErrors() {
+		return nil, diagnostics
+	}
+
+	// Marshal the project to Pulumi.yaml
+	projectBytes, err := encoding.YAML.Marshal(project)
+	if err != nil {
+		return nil, err
+	}
+	files["Pulumi.yaml"] = projectBytes
+
+	return projectFilePaths(directory, files)
+}
+
+// projectFilePaths keys the given files by their paths within directory. It returns an error if any filename would
+// place its file outside of directory.
+func projectFilePaths(directory string, files map[string][]byte) (map[string][]byte, error) {
+	plan := make(map[string][]byte, len(files))
+	for filename, data := range files {
+		// Backslashes are treated as separators on every platform, so that a filename is rejected everywhere if it
+		// would escape directory on Windows.
+		cleaned := filepath.Clean(filepath.FromSlash(strings.ReplaceAll(filename, `\`, "/")))
+		if filepath.IsAbs(cleaned) || filepath.VolumeName(cleaned) != "" || cleaned == "." || cleaned == ".." ||
+			strings.HasPrefix(cleaned, ".."+string(filepath.Separator)) {
+			return nil, fmt.Errorf("output file %q would be written outside of %q", filename, directory)
+		}
+		plan[filepath.Join(directory, cleaned)] = data
+	}
+	return plan, nil
+}
@@ -0,0 +1,3142 @@
+package json
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/blang/semver"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+	"gopkg.in/yaml.v3"
+
+	"github.com/pulumi/pulumi/pkg/v3/codegen/hcl2/model"
+	"github.com/pulumi/pulumi/pkg/v3/codegen/pcl"
+	"github.com/pulumi/pulumi/pkg/v3/codegen/schema"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/workspace"
+)
+
+func TestBinaryOpExpression(t *testing.T) {
+	t.Parallel()
+
+	tree := generateProgramJSON(t, `
+a = 1
+b = 2
+output sum {
+	value = a + b * 3
+}
+output positive {
+	value = a > 0 && b != a
+}
+`)
+
+	requireJSONEq(t, `{
+		"type": "BinaryOpExpression",
+		"operation": "add",
+		"left": {
+			"type": "ScopeTraversalExpression",
+			"rootName": "a",
+			"rootKind": "LocalVariable",
+			"traversal": [{"type": "TraverseRoot", "name": "a"}]
+		},
+		"right": {
+			"type": "BinaryOpExpression",
+			"operation": "multiply",
+			"left": {
+				"type": "ScopeTraversalExpression",
+				"rootName": "b",
+				"rootKind": "LocalVariable",
+				"traversal": [{"type": "TraverseRoot", "name": "b"}]
+			},
+			"right": {"type": "LiteralValueExpression", "value": 3}
+		}
+	}`, findNode(t, tree, "sum")["value"])
+
+	requireJSONEq(t, `{
+		"type": "BinaryOpExpression",
+		"operation": "logicalAnd",
+		"left": {
+			"type": "BinaryOpExpression",
+			"operation": "greaterThan",
+			"left": {
+				"type": "ScopeTraversalExpression",
+				"rootName": "a",
+				"rootKind": "LocalVariable",
+				"traversal": [{"type": "TraverseRoot", "name": "a"}]
+			},
+			"right": {"type": "LiteralValueExpression", "value": 0}
+		},
+		"right": {
+			"type": "BinaryOpExpression",
+			"operation": "notEquals",
+			"left": {
+				"type": "ScopeTraversalExpression",
+				"rootName": "b",
+				"rootKind": "LocalVariable",
+				"traversal": [{"type": "TraverseRoot", "name": "b"}]
+			},
+			"right": {
+				"type": "ScopeTraversalExpression",
+				"rootName": "a",
+				"rootKind": "LocalVariable",
+				"traversal": [{"type": "TraverseRoot", "name": "a"}]
+			}
+		}
+	}`, findNode(t, tree, "positive")["value"])
+}
+
+func TestUnaryOpExpression(t *testing.T) {
+	t.Parallel()
+
+	tree := generateProgramJSON(t, `
+a = 1
+b = 2
+output negativeLiteral {
+	value = -1
+}
+output notLiteral {
+	value = !true
+}
+output negativeSum {
+	value = -(a + b)
+}
+`)
+
+	requireJSONEq(t, `{
+		"type": "UnaryOpExpression",
+		"operation": "negate",
+		"operand": {"type": "LiteralValueExpression", "value": 1}
+	}`, findNode(t, tree, "negativeLiteral")["value"])
+
+	requireJSONEq(t, `{
+		"type": "UnaryOpExpression",
+		"operation": "not",
+		"operand": {"type": "LiteralValueExpression", "value": true}
+	}`, findNode(t, tree, "notLiteral")["value"])
+
+	requireJSONEq(t, `{
+		"type": "UnaryOpExpression",
+		"operation": "negate",
+		"operand": {
+			"type": "BinaryOpExpression",
+			"operation": "add",
+			"left": {
+				"type": "ScopeTraversalExpression",
+				"rootName": "a",
+				"rootKind": "LocalVariable",
+				"traversal": [{"type": "TraverseRoot", "name": "a"}]
+			},
+			"right": {
+				"type": "ScopeTraversalExpression",
+				"rootName": "b",
+				"rootKind": "LocalVariable",
+				"traversal": [{"type": "TraverseRoot", "name": "b"}]
+			}
+		}
+	}`, findNode(t, tree, "negativeSum")["value"])
+}
+
+func TestGenerateProgramFoldConstants(t *testing.T) {
+	t.Parallel()
+
+	program, diags := parseAndBindProgram(t, `
+config enabled "bool" {}
+a = "first"
+b = "second"
+
+sum = 1 + 2 * 3
+negated = !(1 > 2)
+chosen = 1 < 2 ? a : b
+unchanged = enabled ? a : b
+partial = length(a) + 1
+infinite = 1 / 0
+infiniteSum = 1 / 0 + 1
+`, "program.pp")
+	require.False(t, diags.HasErrors(), "failed to bind program: %v", diags)
+
+	files, _, err := GenerateProgramWithOptions(program, GenerateProgramOptions{FoldConstants: true})
+	require.NoError(t, err)
+	var tree map[string]interface{}
+	require.NoError(t, json.Unmarshal(files["program.json"], &tree))
+
+	requireJSONEq(t, `{"type": "LiteralValueExpression", "value": 7}`, findNode(t, tree, "sum")["value"])
+	requireJSONEq(t, `{"type": "LiteralValueExpression", "value": true}`, findNode(t, tree, "negated")["value"])
+	requireJSONEq(t, `{
+		"type": "ScopeTraversalExpression",
+		"rootName": "a",
+		"rootKind": "LocalVariable",
+		"traversal": [{"type": "TraverseRoot", "name": "a"}]
+	}`, findNode(t, tree, "chosen")["value"])
+
+	// Expressions that depend on the program are left as-is.
+	unchanged := findNode(t, tree, "unchanged")["value"].(map[string]interface{})
+	assert.Equal(t, "ConditionalExpression", unchanged["type"])
+	partial := findNode(t, tree, "partial")["value"].(map[string]interface{})
+	assert.Equal(t, "BinaryOpExpression", partial["type"])
+
+	// Operations with infinite results cannot be represented as literals, so they are not folded.
+	requireJSONEq(t, `{
+		"type": "BinaryOpExpression",
+		"operation": "divide",
+		"left": {"type": "LiteralValueExpression", "value": 1},
+		"right": {"type": "LiteralValueExpression", "value": 0}
+	}`, findNode(t, tree, "infinite")["value"])
+	infiniteSum := findNode(t, tree, "infiniteSum")["value"].(map[string]interface{})
+	assert.Equal(t, "add", infiniteSum["operation"])
+	for _, mode := range []NumberMode{NumberNative, NumberString, NumberJSONNumber} {
+		_, _, err := GenerateProgramWithOptions(program, GenerateProgramOptions{FoldConstants: true, NumberMode: mode})
+		assert.NoError(t, err)
+	}
+
+	// Constants are only folded if the option is set.
+	tree = generateProgramJSON(t, `sum = 1 + 2`)
+	assert.Equal(t, "BinaryOpExpression", findNode(t, tree, "sum")["value"].(map[string]interface{})["type"])
+}
+
+func TestConditionalExpression(t *testing.T) {
+	t.Parallel()
+
+	tree := generateProgramJSON(t, `
+config long "bool" {}
+config short "bool" {}
+resource pet "random:index/randomPet:RandomPet" {
+	length = long ? 3 : short ? 1 : 2
+}
+`)
+
+	requireJSONEq(t, `{
+		"type": "ConditionalExpression",
+		"condition": {
+			"type": "ScopeTraversalExpression",
+			"rootName": "long",
+			"rootKind": "ConfigVariable",
+			"traversal": [{"type": "TraverseRoot", "name": "long"}]
+		},
+		"trueResult": {"type": "LiteralValueExpression", "value": 3},
+		"falseResult": {
+			"type": "ConditionalExpression",
+			"condition": {
+				"type": "ScopeTraversalExpression",
+				"rootName": "short",
+				"rootKind": "ConfigVariable",
+				"traversal": [{"type": "TraverseRoot", "name": "short"}]
+			},
+			"trueResult": {"type": "LiteralValueExpression", "value": 1},
+			"falseResult": {"type": "LiteralValueExpression", "value": 2},
+			"resultType": {"kind": "union", "elementTypes": [{"kind": "number"}, {"kind": "number"}]}
+		},
+		"resultType": {"kind": "union", "elementTypes": [{"kind": "number"}, {"kind": "number"}, {"kind": "number"}]}
+	}`, findAttribute(t, findNode(t, tree, "pet"), "length"))
+}
+
+func TestConditionalExpressionResultType(t *testing.T) {
+	t.Parallel()
+
+	tree := generateProgramJSON(t, `
+config long "bool" {}
+config name "string" {}
+resource pet "random:index/randomPet:RandomPet" {
+	prefix = long ? name : "short"
+}
+`)
+
+	conditional := findAttribute(t, findNode(t, tree, "pet"), "prefix").(map[string]interface{})
+	assert.Equal(t, "ConditionalExpression", conditional["type"])
+	requireJSONEq(t, `{"kind": "string"}`, conditional["resultType"])
+}
+
+func TestForExpression(t *testing.T) {
+	t.Parallel()
+
+	tree := generateProgramJSON(t, `
+xs = ["a", "b"]
+m = { a = 1 }
+output list {
+	value = [for v in xs: v if v != "b"]
+}
+output map {
+	value = {for k, v in m: k => v}
+}
+output grouped {
+	value = {for v in xs: v => v...}
+}
+`)
+
+	requireJSONEq(t, `{
+		"type": "ForExpression",
+		"keyVariable": null,
+		"valueVariable": "v",
+		"collection": {
+			"type": "ScopeTraversalExpression",
+			"rootName": "xs",
+			"rootKind": "LocalVariable",
+			"traversal": [{"type": "TraverseRoot", "name": "xs"}]
+		},
+		"key": null,
+		"value": {
+			"type": "ScopeTraversalExpression",
+			"rootName": "v",
+			"rootKind": "unknown",
+			"traversal": [{"type": "TraverseRoot", "name": "v"}]
+		},
+		"condition": {
+			"type": "BinaryOpExpression",
+			"operation": "notEquals",
+			"left": {
+				"type": "ScopeTraversalExpression",
+				"rootName": "v",
+				"rootKind": "unknown",
+				"traversal": [{"type": "TraverseRoot", "name": "v"}]
+			},
+			"right": {
+				"type": "TemplateExpression",
+				"parts": [{"type": "LiteralValueExpression", "value": "b", "literalText": "b"}]
+			}
+		},
+		"group": false
+	}`, findNode(t, tree, "list")["value"])
+
+	requireJSONEq(t, `{
+		"type": "ForExpression",
+		"keyVariable": "k",
+		"valueVariable": "v",
+		"collection": {
+			"type": "ScopeTraversalExpression",
+			"rootName": "m",
+			"rootKind": "LocalVariable",
+			"traversal": [{"type": "TraverseRoot", "name": "m"}]
+		},
+		"key": {
+			"type": "ScopeTraversalExpression",
+			"rootName": "k",
+			"rootKind": "unknown",
+			"traversal": [{"type": "TraverseRoot", "name": "k"}]
+		},
+		"value": {
+			"type": "ScopeTraversalExpression",
+			"rootName": "v",
+			"rootKind": "unknown",
+			"traversal": [{"type": "TraverseRoot", "name": "v"}]
+		},
+		"condition": null,
+		"group": false
+	}`, findNode(t, tree, "map")["value"])
+
+	grouped := findNode(t, tree, "grouped")["value"].(map[string]interface{})
+	assert.Equal(t, "ForExpression", grouped["type"])
+	assert.Equal(t, true, grouped["group"])
+}
+
+func TestSplatExpression(t *testing.T) {
+	t.Parallel()
+
+	tree := generateProgramJSON(t, `
+resource pets "random:index/randomPet:RandomPet" {
+	options { range = 2 }
+	length = 2
+}
+output ids {
+	value = pets[*].id
+}
+`)
+
+	requireJSONEq(t, `{
+		"type": "SplatExpression",
+		"source": {
+			"type": "ScopeTraversalExpression",
+			"rootName": "pets",
+			"rootKind": "Resource",
+			"traversal": [{"type": "TraverseRoot", "name": "pets"}]
+		},
+		"each": {
+			"type": "ScopeTraversalExpression",
+			"rootName": "",
+			"rootKind": "unknown",
+			"traversal": [{"type": "TraverseRoot", "name": ""}, {"type": "TraverseAttr", "name": "id"}]
+		},
+		"item": {"type": "SplatVariable", "name": ""}
+	}`, findNode(t, tree, "ids")["value"])
+}
+
+type nameInfo int
+
+func (nameInfo) Format(name string) string {
+	return name
+}
+
+func TestAnonymousFunctionExpression(t *testing.T) {
+	t.Parallel()
+
+	program, diags := parseAndBindProgram(t, `
+resource first "random:index/randomPet:RandomPet" {}
+resource second "random:index/randomPet:RandomPet" {}
+output ids {
+	value = "${first.id}-${second.id}"
+}
+`, "program.pp")
+	require.False(t, diags.HasErrors(), "failed to bind program: %v", diags)
+
+	var output *pcl.OutputVariable
+	for _, node := range program.Nodes {
+		if o, ok := node.(*pcl.OutputVariable); ok {
+			output = o
+		}
+	}
+	require.NotNil(t, output)
+
+	value, diags := pcl.RewriteApplies(output.Value, nameInfo(0), false)
+	require.Empty(t, diags)
+
+	apply := (&generator{}).transformExpression(value)
+	assert.Equal(t, "FunctionCallExpression", apply["type"])
+	assert.Equal(t, pcl.IntrinsicApply, apply["name"])
+
+	args := apply["args"].([]interface{})
+	requireJSONEq(t, `{
+		"type": "AnonymousFunctionExpression",
+		"parameters": [{"name": "firstId"}, {"name": "secondId"}],
+		"body": {
+			"type": "TemplateExpression",
+			"parts": [
+				{
+					"type": "ScopeTraversalExpression",
+					"rootName": "firstId",
+					"rootKind": "unknown",
+					"traversal": [{"type": "TraverseRoot", "name": "firstId"}]
+				},
+				{"type": "LiteralValueExpression", "value": "-", "literalText": "-"},
+				{
+					"type": "ScopeTraversalExpression",
+					"rootName": "secondId",
+					"rootKind": "unknown",
+					"traversal": [{"type": "TraverseRoot", "name": "secondId"}]
+				}
+			]
+		}
+	}`, args[len(args)-1])
+}
+
+func TestUnsupportedExpression(t *testing.T) {
+	t.Parallel()
+
+	g := &generator{}
+	requireJSONEq(t, `{
+		"type": "UnsupportedExpression",
+		"exprType": "*model.ErrorExpression",
+		"tokens": "error(\"oops\")"
+	}`, g.transformExpression(&model.ErrorExpression{Message: "oops"}))
+
+	require.Len(t, g.diagnostics, 1)
+	assert.Equal(t, hcl.DiagWarning, g.diagnostics[0].Severity)
+	assert.Equal(t, "json-codegen: unsupported expression type *model.ErrorExpression was not serialized",
+		g.diagnostics[0].Summary)
+}
+
+// customExpression stands in for an expression type produced by a pass outside of the model package.
+type customExpression struct {
+	*model.ErrorExpression
+}
+
+func TestRegisterExpressionTransformer(t *testing.T) {
+	t.Parallel()
+
+	var transformed []model.Expression
+	RegisterExpressionTransformer(reflect.TypeOf(&customExpression{}), func(expr model.Expression) map[string]interface{} {
+		transformed = append(transformed, expr)
+		return map[string]interface{}{
+			"type":    "CustomExpression",
+			"message": expr.(*customExpression).Message,
+		}
+	})
+
+	expr := &customExpression{ErrorExpression: &model.ErrorExpression{Message: "custom"}}
+	g := &generator{}
+	requireJSONEq(t, `{
+		"type": "TupleConsExpression",
+		"items": [{"type": "CustomExpression", "message": "custom"}]
+	}`, g.transformExpression(&model.TupleConsExpression{Expressions: []model.Expression{expr}}))
+	assert.Empty(t, g.diagnostics)
+	assert.Equal(t, []model.Expression{expr}, transformed)
+}
+
+func TestLiteralValueExpressionIntegerPrecision(t *testing.T) {
+	t.Parallel()
+
+	program, diags := parseAndBindProgram(t, `
+output big {
+	value = 123456789012345678
+}
+output fraction {
+	value = 0.5
+}
+`, "program.pp")
+	require.False(t, diags.HasErrors(), "failed to bind program: %v", diags)
+
+	files, _, err := GenerateProgram(program)
+	require.NoError(t, err)
+
+	decoder := json.NewDecoder(bytes.NewReader(files["program.json"]))
+	decoder.UseNumber()
+	var tree map[string]interface{}
+	require.NoError(t, decoder.Decode(&tree))
+
+	big := findNode(t, tree, "big")["value"].(map[string]interface{})
+	assert.Equal(t, json.Number("123456789012345678"), big["value"])
+
+	fraction := findNode(t, tree, "fraction")["value"].(map[string]interface{})
+	assert.Equal(t, json.Number("0.5"), fraction["value"])
+}
+
+func TestLiteralValueExpressionNumberMode(t *testing.T) {
+	t.Parallel()
+
+	program, diags := parseAndBindProgram(t, `
+output big {
+	value = 12345678901234567890123
+}
+output fraction {
+	value = 0.1
+}
+`, "program.pp")
+	require.False(t, diags.HasErrors(), "failed to bind program: %v", diags)
+
+	cases := []struct {
+		mode     NumberMode
+		big      string
+		fraction string
+	}{
+		{NumberNative, `12345678901234567890123`, `0.1`},
+		{NumberString, `"12345678901234567890123"`, `"0.1"`},
+		{NumberJSONNumber, `12345678901234567890123`, `0.1`},
+	}
+	for _, c := range cases {
+		files, _, err := GenerateProgramWithOptions(program, GenerateProgramOptions{NumberMode: c.mode})
+		require.NoError(t, err)
+
+		decoder := json.NewDecoder(bytes.NewReader(files["program.json"]))
+		decoder.UseNumber()
+		var tree map[string]interface{}
+		require.NoError(t, decoder.Decode(&tree))
+
+		big := findNode(t, tree, "big")["value"].(map[string]interface{})
+		requireJSONEq(t, c.big, big["value"])
+		fraction := findNode(t, tree, "fraction")["value"].(map[string]interface{})
+		requireJSONEq(t, c.fraction, fraction["value"])
+	}
+
+	// Fractions that cannot be represented exactly as a float64 keep their exact text unless emitted natively.
+	precise := cty.MustParseNumberVal("0.12345678901234567890123")
+	assert.Equal(t, 0.12345678901234568, transformNumberWithMode(precise, NumberNative))
+	assert.Equal(t, "0.12345678901234567890123", transformNumberWithMode(precise, NumberString))
+	assert.Equal(t, json.Number("0.12345678901234567890123"), transformNumberWithMode(precise, NumberJSONNumber))
+}
+
+func TestDiagnosticSeverities(t *testing.T) {
+	t.Parallel()
+
+	program, diags := parseAndBindProgram(t, `
+dropped = "dropped"
+output missing {
+	value = "missing"
+}
+`, "program.pp")
+	require.False(t, diags.HasErrors(), "failed to bind program: %v", diags)
+	var missing *pcl.OutputVariable
+	for _, node := range program.Nodes {
+		switch node := node.(type) {
+		case *pcl.LocalVariable:
+			node.Definition.Value = &model.ErrorExpression{Message: "dropped"}
+		case *pcl.OutputVariable:
+			missing = node
+		}
+	}
+	missingValue := missing.Value
+	missing.Value = nil
+
+	_, diags, err := GenerateProgram(program)
+	require.NoError(t, err)
+	severities := map[string]hcl.DiagnosticSeverity{}
+	for _, diag := range diags {
+		severities[diag.Summary] = diag.Severity
+	}
+	assert.Equal(t, map[string]hcl.DiagnosticSeverity{
+		"json-codegen: unsupported expression type *model.ErrorExpression was not serialized": hcl.DiagWarning,
+		"json-codegen: missing has no value":                                                  hcl.DiagError,
+	}, severities)
+
+	// Projects are only rejected for errors.
+	_, err = GenerateProjectPlan("out", workspace.Project{Name: "project"}, program)
+	var planDiags hcl.Diagnostics
+	require.ErrorAs(t, err, &planDiags)
+	assert.True(t, planDiags.HasErrors())
+
+	missing.Value = missingValue
+	_, err = GenerateProjectPlan("out", workspace.Project{Name: "project"}, program)
+	assert.NoError(t, err)
+}
+
+func TestGenerateProgramMissingValues(t *testing.T) {
+	t.Parallel()
+
+	program, diags := parseAndBindProgram(t, `
+resource pet "random:index/randomPet:RandomPet" {
+	prefix = "pet"
+}
+greeting = "hello"
+output message {
+	value = greeting
+}
+`, "program.pp")
+	require.False(t, diags.HasErrors(), "failed to bind program: %v", diags)
+
+	// Simulate a partially-bound program by dropping every value.
+	for _, node := range program.Nodes {
+		switch node := node.(type) {
+		case *pcl.Resource:
+			node.Inputs[0].Value = nil
+		case *pcl.LocalVariable:
+			node.Definition.Value = nil
+		case *pcl.OutputVariable:
+			node.Value = nil
+		}
+	}
+
+	files, diags, err := GenerateProgram(program)
+	require.NoError(t, err)
+	summaries := make([]string, 0, len(diags))
+	for _, diag := range diags {
+		assert.Equal(t, hcl.DiagError, diag.Severity)
+		summaries = append(summaries, diag.Summary)
+	}
+	assert.ElementsMatch(t, []string{
+		"json-codegen: pet.prefix has no value",
+		"json-codegen: greeting has no value",
+		"json-codegen: message has no value",
+	}, summaries)
+
+	parsed, err := ParseProgram(files["program.json"])
+	require.NoError(t, err)
+	for _, node := range parsed.Nodes {
+		var value Expression
+		switch node := node.(type) {
+		case *Resource:
+			value = node.Attributes["prefix"].Value
+		case *LocalVariable:
+			value = node.Value
+		case *OutputVariable:
+			value = node.Value
+		}
+		assert.Equal(t, &NullExpression{}, value, node.NodeType())
+	}
+}
+
+func TestLiteralValueExpressionNull(t *testing.T) {
+	t.Parallel()
+
+	tree := generateProgramJSON(t, `
+resource pet "random:index/randomPet:RandomPet" {
+	prefix = null
+}
+`)
+
+	requireJSONEq(t, `{
+		"type": "LiteralValueExpression",
+		"value": null,
+		"isNull": true
+	}`, findAttribute(t, findNode(t, tree, "pet"), "prefix"))
+
+	g := &generator{}
+	unsupported := g.transformExpression(&model.LiteralValueExpression{
+		Value: cty.SetVal([]cty.Value{cty.StringVal("a")}),
+	})
+	requireJSONEq(t, `{
+		"type": "UnsupportedExpression",
+		"exprType": "*model.LiteralValueExpression",
+		"valueType": "set of string"
+	}`, unsupported)
+	require.Len(t, g.diagnostics, 1)
+	assert.Equal(t, hcl.DiagWarning, g.diagnostics[0].Severity)
+
+	_, err := ExpressionToJSON(&model.LiteralValueExpression{Value: cty.SetVal([]cty.Value{cty.StringVal("a")})})
+	assert.Error(t, err)
+}
+
+func TestObjectConsExpressionComputedKeys(t *testing.T) {
+	t.Parallel()
+
+	program, diags := parseAndBindProgram(t, `
+config prefix "string" {}
+output tags {
+	value = {
+		first = 1
+		(prefix) = 2
+	}
+}
+`, "program.pp")
+	require.False(t, diags.HasErrors(), "failed to bind program: %v", diags)
+
+	// Computed keys are kept as key expressions, so no item is dropped and no diagnostic is reported.
+	files, diags, err := GenerateProgram(program)
+	require.NoError(t, err)
+	assert.Empty(t, diags)
+	var tree map[string]interface{}
+	require.NoError(t, json.Unmarshal(files["program.json"], &tree))
+
+	requireJSONEq(t, `{
+		"type": "ObjectConsExpression",
+		"objectKind": "map",
+		"properties": [
+			{
+				"key": {"type": "LiteralValueExpression", "value": "first"},
+				"value": {"type": "LiteralValueExpression", "value": 1}
+			},
+			{
+				"key": {
+					"type": "ScopeTraversalExpression",
+					"rootName": "prefix",
+					"rootKind": "ConfigVariable",
+					"traversal": [{"type": "TraverseRoot", "name": "prefix"}]
+				},
+				"value": {"type": "LiteralValueExpression", "value": 2}
+			}
+		]
+	}`, findNode(t, tree, "tags")["value"])
+}
+
+func TestResourceOptions(t *testing.T) {
+	t.Parallel()
+
+	tree := generateProgramJSON(t, `
+resource provider "pulumi:providers:random" {}
+resource first "random:index/randomPet:RandomPet" {}
+resource second "random:index/randomPet:RandomPet" {
+	length = 2
+
+	options {
+		protect = true
+		dependsOn = [first]
+		provider = provider
+		parent = first
+		ignoreChanges = [length]
+	}
+}
+`)
+
+	assert.Nil(t, findNode(t, tree, "first")["options"])
+	requireJSONEq(t, `{
+		"protect": {"type": "LiteralValueExpression", "value": true},
+		"dependsOn": [
+			{
+				"type": "ScopeTraversalExpression",
+				"rootName": "first",
+				"rootKind": "Resource",
+				"traversal": [{"type": "TraverseRoot", "name": "first"}]
+			}
+		],
+		"provider": {
+			"type": "ScopeTraversalExpression",
+			"rootName": "provider",
+			"rootKind": "Resource",
+			"traversal": [{"type": "TraverseRoot", "name": "provider"}]
+		},
+		"parent": {
+			"type": "ScopeTraversalExpression",
+			"rootName": "first",
+			"rootKind": "Resource",
+			"traversal": [{"type": "TraverseRoot", "name": "first"}]
+		},
+		"ignoreChanges": [
+			{
+				"type": "ScopeTraversalExpression",
+				"rootName": "length",
+				"rootKind": "unknown",
+				"traversal": [{"type": "TraverseRoot", "name": "length"}]
+			}
+		],
+		"range": null,
+		"version": null,
+		"pluginDownloadURL": null,
+		"aliases": null
+	}`, findNode(t, tree, "second")["options"])
+}
+
+func TestResourceAliases(t *testing.T) {
+	t.Parallel()
+
+	program, diags := parseAndBindProgram(t, `
+resource parent "random:index/randomPet:RandomPet" {}
+resource pet "random:index/randomPet:RandomPet" {
+	options {
+		aliases = [
+			{ name = "old-pet", parent = parent },
+			{ name = "older-pet", type = "random:index/randomString:RandomString", stack = "dev", project = "pets" },
+			"urn:pulumi:dev::pets::random:index/randomPet:RandomPet::legacy",
+		]
+	}
+}
+`, "program.pp")
+	// The binder does not support aliases, but the bound value is still serialized, with a warning.
+	require.Len(t, diags, 1)
+	assert.Contains(t, diags[0].Summary, "unsupported attribute 'aliases'")
+
+	files, diags, err := GenerateProgram(program)
+	require.NoError(t, err)
+	require.Len(t, diags, 1)
+	assert.Equal(t, hcl.DiagWarning, diags[0].Severity)
+	assert.Equal(t, "json-codegen: aliases are not supported by the PCL binder and were serialized from a program that "+
+		"failed to bind", diags[0].Summary)
+	var tree map[string]interface{}
+	require.NoError(t, json.Unmarshal(files["program.json"], &tree))
+
+	str := func(value string) string {
+		return fmt.Sprintf(`{"type": "TemplateExpression", "parts": [
+			{"type": "LiteralValueExpression", "value": %[1]q, "literalText": %[1]q}
+		]}`, value)
+	}
+	requireJSONEq(t, `[
+		{
+			"name": `+str("old-pet")+`,
+			"parent": {
+				"type": "ScopeTraversalExpression",
+				"rootName": "parent",
+				"rootKind": "Resource",
+				"traversal": [{"type": "TraverseRoot", "name": "parent"}]
+			}
+		},
+		{
+			"name": `+str("older-pet")+`,
+			"type": `+str("random:index/randomString:RandomString")+`,
+			"stack": `+str("dev")+`,
+			"project": `+str("pets")+`
+		},
+		{"value": `+str("urn:pulumi:dev::pets::random:index/randomPet:RandomPet::legacy")+`}
+	]`, findNode(t, tree, "pet")["options"].(map[string]interface{})["aliases"])
+
+	parsed, err := ParseProgram(files["program.json"])
+	require.NoError(t, err)
+	for _, node := range parsed.Nodes {
+		if resource := node.(*Resource); resource.Name == "pet" {
+			require.Len(t, resource.Options.Aliases, 3)
+			assert.IsType(t, &ScopeTraversalExpression{}, resource.Options.Aliases[0].Parent)
+			assert.Nil(t, resource.Options.Aliases[0].Type)
+			assert.IsType(t, &TemplateExpression{}, resource.Options.Aliases[2].Value)
+		}
+	}
+}
+
+func TestResourceRange(t *testing.T) {
+	t.Parallel()
+
+	tree := generateProgramJSON(t, `
+names = ["a", "b"]
+resource counted "random:index/randomPet:RandomPet" {
+	options { range = 3 }
+}
+resource iterated "random:index/randomPet:RandomPet" {
+	options { range = names }
+	prefix = range.value
+}
+`)
+
+	requireJSONEq(t, `{
+		"expression": {"type": "LiteralValueExpression", "value": 3},
+		"isCount": true
+	}`, findNode(t, tree, "counted")["options"].(map[string]interface{})["range"])
+
+	requireJSONEq(t, `{
+		"expression": {
+			"type": "ScopeTraversalExpression",
+			"rootName": "names",
+			"rootKind": "LocalVariable",
+			"traversal": [{"type": "TraverseRoot", "name": "names"}]
+		},
+		"isCount": false
+	}`, findNode(t, tree, "iterated")["options"].(map[string]interface{})["range"])
+}
+
+func TestResourceAttributeSchemaTypes(t *testing.T) {
+	t.Parallel()
+
+	tree := generateProgramJSON(t, `
+resource str "random:index/randomString:RandomString" {
+	length = 8
+	special = false
+	keepers = { a = "b" }
+	overrideSpecial = "_"
+}
+`)
+
+	attributes := findNode(t, tree, "str")["attributes"].(map[string]interface{})
+	schemaTypes := map[string]interface{}{}
+	for name, attribute := range attributes {
+		schemaTypes[name] = attribute.(map[string]interface{})["schemaType"]
+	}
+	assert.Equal(t, map[string]interface{}{
+		"length":          "integer",
+		"special":         "boolean",
+		"keepers":         "map",
+		"overrideSpecial": "string",
+	}, schemaTypes)
+
+	resource := (&generator{}).transformResource(&pcl.Resource{
+		Definition: &model.Block{Labels: []string{"unbound"}},
+		Token:      "unknown:index:Resource",
+		Inputs: []*model.Attribute{{
+			Name:  "value",
+			Value: &model.LiteralValueExpression{Value: cty.StringVal("v")},
+		}},
+	})
+	requireJSONEq(t, `{
+		"value": {
+			"value": {"type": "LiteralValueExpression", "value": "v"},
+			"schemaType": null
+		}
+	}`, resource["attributes"])
+}
+
+func TestGenerateProgramStream(t *testing.T) {
+	t.Parallel()
+
+	program, diags := parseAndBindProgram(t, `
+config prefix "string" {}
+resource pet "random:index/randomPet:RandomPet" {
+	prefix = prefix
+}
+output name {
+	value = pet.id
+}
+`, "program.pp")
+	require.False(t, diags.HasErrors(), "failed to bind program: %v", diags)
+
+	files, _, err := GenerateProgram(program)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	diags, err = GenerateProgramStream(program, &buf)
+	require.NoError(t, err)
+	assert.Empty(t, diags)
+	assert.JSONEq(t, string(files["program.json"]), buf.String())
+}
+
+// syntheticProgram returns the source of a program that declares the given number of resources.
+func syntheticProgram(resources int) string {
+	var source strings.Builder
+	for i := 0; i < resources; i++ {
+		fmt.Fprintf(&source, "resource pet%d \"random:index/randomPet:RandomPet\" {\n\tprefix = \"pet-%d\"\n}\n", i, i)
+	}
+	return source.String()
+}
+
+func BenchmarkGenerateProgram(b *testing.B) {
+	program, diags := parseAndBindProgram(b, syntheticProgram(1000), "program.pp")
+	require.False(b, diags.HasErrors(), "failed to bind program: %v", diags)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		_, _, err := GenerateProgram(program)
+		require.NoError(b, err)
+	}
+}
+
+func BenchmarkGenerateProgramStream(b *testing.B) {
+	program, diags := parseAndBindProgram(b, syntheticProgram(1000), "program.pp")
+	require.False(b, diags.HasErrors(), "failed to bind program: %v", diags)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		_, err := GenerateProgramStream(program, io.Discard)
+		require.NoError(b, err)
+	}
+}
+
+// nestedProgram returns the source of a program with an output whose value is an object nested to the given depth.
+// Each level also holds a tuple so that tuple items are exercised alongside object properties.
+func nestedProgram(depth int) string {
+	var source strings.Builder
+	source.WriteString("output nested {\n\tvalue = ")
+	for i := 0; i < depth; i++ {
+		fmt.Fprintf(&source, "{ items = [%d, \"item-%d\"], child = ", i, i)
+	}
+	source.WriteString("null")
+	source.WriteString(strings.Repeat(" }", depth))
+	source.WriteString("\n}\n")
+	return source.String()
+}
+
+func BenchmarkGenerateProgramDeepNesting(b *testing.B) {
+	program, diags := parseAndBindProgram(b, nestedProgram(500), "program.pp")
+	require.False(b, diags.HasErrors(), "failed to bind program: %v", diags)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		_, _, err := GenerateProgram(program)
+		require.NoError(b, err)
+	}
+}
+
+//nolint:paralleltest // AllocsPerRun cannot be used in parallel tests
+func TestGenerateProgramDeepNestingAllocations(t *testing.T) {
+	allocations := func(depth int) float64 {
+		program, diags := parseAndBindProgram(t, nestedProgram(depth), "program.pp")
+		require.False(t, diags.HasErrors(), "failed to bind program: %v", diags)
+
+		return testing.AllocsPerRun(5, func() {
+			_, _, err := GenerateProgram(program)
+			require.NoError(t, err)
+		})
+	}
+
+	// Doubling the nesting depth should roughly double the allocations. Anything much worse suggests that the
+	// transform has become quadratic in the depth of the expression.
+	shallow, deep := allocations(100), allocations(200)
+	assert.Less(t, deep, 2.5*shallow, "allocations grew from %v to %v when doubling the depth", shallow, deep)
+}
+
+func TestGenerateProgramDeterministic(t *testing.T) {
+	t.Parallel()
+
+	const source = `
+resource pet "random:index/randomPet:RandomPet" {
+	prefix = "pet"
+	length = 2
+	separator = "-"
+	keepers = { b = 1, a = 2 }
+}
+resource bucket "aws:s3/bucket:Bucket" {
+	tags = { z = "z", y = "y" }
+}
+output names {
+	value = [pet.id, bucket.id]
+}
+`
+
+	cache := pcl.NewPackageCache()
+	generate := func() []byte {
+		program, diags := parseAndBindProgram(t, source, "program.pp", pcl.Cache(cache))
+		require.False(t, diags.HasErrors(), "failed to bind program: %v", diags)
+		files, _, err := GenerateProgram(program)
+		require.NoError(t, err)
+		return files["program.json"]
+	}
+
+	expected := generate()
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, string(expected), string(generate()))
+	}
+
+	var tree map[string]interface{}
+	require.NoError(t, json.Unmarshal(expected, &tree))
+	packages := tree["packages"].([]interface{})
+	require.Len(t, packages, 2)
+	assert.Equal(t, "aws", packages[0].(map[string]interface{})["name"])
+	assert.Equal(t, "random", packages[1].(map[string]interface{})["name"])
+}
+
+func TestPackageLess(t *testing.T) {
+	t.Parallel()
+
+	v1, v2 := semver.MustParse("1.0.0"), semver.MustParse("2.0.0")
+	assert.True(t, packageLess(&schema.Package{Name: "a", Version: &v2}, &schema.Package{Name: "b", Version: &v1}))
+	assert.True(t, packageLess(&schema.Package{Name: "a", Version: &v1}, &schema.Package{Name: "a", Version: &v2}))
+	assert.True(t, packageLess(&schema.Package{Name: "a"}, &schema.Package{Name: "a", Version: &v1}))
+	assert.False(t, packageLess(&schema.Package{Name: "a"}, &schema.Package{Name: "a"}))
+}
+
+func TestGenerateProgramWithOptions(t *testing.T) {
+	t.Parallel()
+
+	source := `
+resource pet "random:index/randomPet:RandomPet" {
+	length = 2
+}
+
+output name {
+	value = pet.id
+}
+`
+	program, diags := parseAndBindProgram(t, source, "program.pp")
+	require.False(t, diags.HasErrors(), "failed to bind program: %v", diags)
+
+	defaults, _, err := GenerateProgram(program)
+	require.NoError(t, err)
+	assert.Contains(t, string(defaults["program.json"]), "\n  \"nodes\"")
+
+	compact, _, err := GenerateProgramWithOptions(program, GenerateProgramOptions{Compact: true})
+	require.NoError(t, err)
+	assert.NotContains(t, string(compact["program.json"]), "\n")
+	assert.JSONEq(t, string(defaults["program.json"]), string(compact["program.json"]))
+
+	tabs, _, err := GenerateProgramWithOptions(program, GenerateProgramOptions{Indent: "\t"})
+	require.NoError(t, err)
+	assert.Contains(t, string(tabs["program.json"]), "\n\t\"nodes\"")
+	assert.NotContains(t, string(tabs["program.json"]), "\n  ")
+	assert.JSONEq(t, string(defaults["program.json"]), string(tabs["program.json"]))
+}
+
+func TestConfigVariableDefaultValue(t *testing.T) {
+	t.Parallel()
+
+	tree := generateProgramJSON(t, `
+config region "string" {
+	default = "us-west-2"
+}
+
+config zone "string" {}
+`)
+
+	requireJSONEq(t, `{
+		"type": "TemplateExpression",
+		"parts": [{"type": "LiteralValueExpression", "value": "us-west-2", "literalText": "us-west-2"}]
+	}`,
+		findNode(t, tree, "region")["defaultValue"])
+
+	zone := findNode(t, tree, "zone")
+	assert.Contains(t, zone, "defaultValue")
+	assert.Nil(t, zone["defaultValue"])
+}
+
+func TestConfigVariableDescriptionAndNullable(t *testing.T) {
+	t.Parallel()
+
+	tree := generateProgramJSON(t, `
+config region "string" {
+	description = "The region to deploy into"
+	nullable = true
+}
+
+config zone "string" {}
+`)
+
+	region := findNode(t, tree, "region")
+	assert.Equal(t, "The region to deploy into", region["description"])
+	assert.Equal(t, true, region["nullable"])
+
+	zone := findNode(t, tree, "zone")
+	assert.Equal(t, "", zone["description"])
+	assert.Equal(t, false, zone["nullable"])
+}
+
+func TestConfigVariableTypes(t *testing.T) {
+	t.Parallel()
+
+	tree := generateProgramJSON(t, `
+config name "string" {}
+config names "list(string)" {}
+config weights "map(number)" {}
+`)
+
+	requireJSONEq(t, `{"kind":"string"}`, findNode(t, tree, "name")["configType"])
+	requireJSONEq(t, `{"kind":"list","elementType":{"kind":"string"}}`, findNode(t, tree, "names")["configType"])
+	requireJSONEq(t, `{"kind":"map","elementType":{"kind":"number"}}`, findNode(t, tree, "weights")["configType"])
+}
+
+func TestConfigVariableAllowedValues(t *testing.T) {
+	t.Parallel()
+
+	region := model.NewEnumType("aws:index:Region", model.StringType,
+		[]cty.Value{cty.StringVal("us-east-1"), cty.StringVal("us-west-2")})
+	values, ok := allowedValues(region)
+	require.True(t, ok)
+	assert.Equal(t, []interface{}{"us-east-1", "us-west-2"}, values)
+
+	_, ok = allowedValues(model.StringType)
+	assert.False(t, ok)
+
+	// Config variables bound from source cannot have enum types, so GenerateProgram never emits allowed values.
+	tree := generateProgramJSON(t, `
+config region "string" {}
+`)
+	assert.NotContains(t, findNode(t, tree, "region"), "allowedValues")
+}
+
+func TestConfigVariableObjectType(t *testing.T) {
+	t.Parallel()
+
+	tree := generateProgramJSON(t, `
+config users "list(object({name=string, tags=map(object({enabled=bool}))}))" {}
+`)
+
+	requireJSONEq(t, `{
+		"kind": "list",
+		"elementType": {
+			"kind": "object",
+			"properties": {
+				"name": {"kind": "string"},
+				"tags": {
+					"kind": "map",
+					"elementType": {"kind": "object", "properties": {"enabled": {"kind": "bool"}}}
+				}
+			}
+		}
+	}`, findNode(t, tree, "users")["configType"])
+}
+
+func TestTransformType(t *testing.T) {
+	t.Parallel()
+
+	object := model.NewObjectType(map[string]model.Type{
+		"id":   model.IntType,
+		"tags": model.NewTupleType(model.BoolType, model.DynamicType),
+	})
+	requireJSONEq(t, `{
+		"kind": "object",
+		"properties": {
+			"id": {"kind": "int"},
+			"tags": {"kind": "tuple", "elementTypes": [{"kind": "bool"}, {"kind": "dynamic"}]}
+		}
+	}`, transformType(object))
+
+	requireJSONEq(t, `{"kind":"output","elementType":{"kind":"opaque","name":"Asset"}}`,
+		transformType(model.NewOutputType(model.NewOpaqueType("Asset"))))
+}
+
+func TestTupleConsExpressionElementTypes(t *testing.T) {
+	t.Parallel()
+
+	tree := generateProgramJSON(t, `
+resource bucket "aws:s3/bucket:Bucket" {
+	corsRules = [{ allowedMethods = ["GET", "PUT"], allowedOrigins = ["*"] }]
+}
+
+mixed = [1, "two", true]
+nested = [1, [2]]
+empty = []
+`)
+
+	bucket := findNode(t, tree, "bucket")
+	corsRules := findAttribute(t, bucket, "corsRules").(map[string]interface{})
+	// The element types of nested constructors are shallow, as the constructors carry their own types.
+	requireJSONEq(t, `{"kind": "object"}`, corsRules["elementType"])
+	rule := corsRules["items"].([]interface{})[0].(map[string]interface{})
+	allowedMethodsProperty := rule["properties"].([]interface{})[0].(map[string]interface{})
+	requireJSONEq(t, `{"kind": "tuple"}`, allowedMethodsProperty["type"])
+	allowedMethods := allowedMethodsProperty["value"].(map[string]interface{})
+	requireJSONEq(t, `{"kind": "string"}`, allowedMethods["elementType"])
+
+	mixed := findNode(t, tree, "mixed")["value"].(map[string]interface{})
+	assert.NotContains(t, mixed, "elementType")
+	requireJSONEq(t, `[{"kind": "number"}, {"kind": "string"}, {"kind": "bool"}]`, mixed["elementTypes"])
+
+	nested := findNode(t, tree, "nested")["value"].(map[string]interface{})
+	requireJSONEq(t, `[{"kind": "number"}, {"kind": "tuple"}]`, nested["elementTypes"])
+
+	empty := findNode(t, tree, "empty")["value"].(map[string]interface{})
+	assert.NotContains(t, empty, "elementType")
+	assert.NotContains(t, empty, "elementTypes")
+}
+
+func TestInvokeExpression(t *testing.T) {
+	t.Parallel()
+
+	tree := generateProgramJSON(t, `
+ami = invoke("aws:index:getAmi", {
+	owners = ["137112412989"]
+	mostRecent = true
+})
+`)
+
+	// The return type describes the whole result of the data source, so it is checked separately.
+	ami := findNode(t, tree, "ami")["value"].(map[string]interface{})
+	returnType := ami["returnType"].(map[string]interface{})
+	delete(ami, "returnType")
+
+	requireJSONEq(t, `{
+		"type": "Invoke",
+		"token": "aws::getAmi",
+		"args": {
+			"owners": {"type": "TupleConsExpression", "elementType": {"kind": "string"}, "items": [
+				{"type": "TemplateExpression", "parts": [
+					{"type": "LiteralValueExpression", "value": "137112412989", "literalText": "137112412989"}
+				]}
+			]},
+			"mostRecent": {"type": "LiteralValueExpression", "value": true}
+		},
+		"options": null
+	}`, ami)
+
+	assert.Equal(t, "promise", returnType["kind"])
+	properties := returnType["elementType"].(map[string]interface{})["properties"].(map[string]interface{})
+	assert.Contains(t, properties, "imageId")
+}
+
+func TestGenerateProgramRanges(t *testing.T) {
+	t.Parallel()
+
+	program, diags := parseAndBindProgram(t, `output greeting {
+	value = "hello"
+}
+`, "program.pp")
+	require.False(t, diags.HasErrors(), "failed to bind program: %v", diags)
+
+	files, _, err := GenerateProgram(program)
+	require.NoError(t, err)
+	assert.NotContains(t, string(files["program.json"]), `"range"`)
+
+	files, _, err = GenerateProgramWithOptions(program, GenerateProgramOptions{IncludeRanges: true})
+	require.NoError(t, err)
+
+	parsed, err := ParseProgram(files["program.json"])
+	require.NoError(t, err)
+	require.Len(t, parsed.Nodes, 1)
+
+	output := parsed.Nodes[0].(*OutputVariable)
+	require.NotNil(t, output.Range)
+	assert.Equal(t, "program.pp", output.Range.Filename)
+	// The syntax parser starts each file at the zero position, so the first line is line 0.
+	assert.Equal(t, SourcePos{Line: 0, Column: 0, Byte: 0}, output.Range.Start)
+	assert.Equal(t, 2, output.Range.End.Line)
+
+	value := output.Value.(*TemplateExpression)
+	require.NotNil(t, value.Range)
+	assert.Equal(t, SourcePos{Line: 1, Column: 10, Byte: 27}, value.Range.Start)
+	assert.Equal(t, SourcePos{Line: 1, Column: 17, Byte: 34}, value.Range.End)
+}
+
+func TestGenerateProgramSourceText(t *testing.T) {
+	t.Parallel()
+
+	source := `config names "list(string)" {}
+
+output count {
+	value = length(names) + 1
+}
+`
+	program, diags := parseAndBindProgram(t, source, "program.pp")
+	require.False(t, diags.HasErrors(), "failed to bind program: %v", diags)
+
+	files, _, err := GenerateProgram(program)
+	require.NoError(t, err)
+	assert.NotContains(t, string(files["program.json"]), `"sourceText"`)
+
+	files, _, err = GenerateProgramWithOptions(program, GenerateProgramOptions{IncludeSourceText: true})
+	require.NoError(t, err)
+	assert.NotContains(t, string(files["program.json"]), `"range"`)
+
+	parsed, err := ParseProgram(files["program.json"])
+	require.NoError(t, err)
+
+	var output *OutputVariable
+	for _, node := range parsed.Nodes {
+		if o, ok := node.(*OutputVariable); ok {
+			output = o
+		}
+	}
+	require.NotNil(t, output)
+
+	value := output.Value.(*BinaryOpExpression)
+	assert.Equal(t, "length(names) + 1", value.SourceText)
+	assert.Equal(t, "length(names)", value.Left.(*FunctionCallExpression).SourceText)
+	assert.Equal(t, "1", value.Right.(*LiteralValueExpression).SourceText)
+}
+
+func TestTemplateJoinExpression(t *testing.T) {
+	t.Parallel()
+
+	tree := generateProgramJSON(t, `
+config names "list(string)" {}
+
+greeting = "hello%{ for name in names } ${name}%{ endfor }"
+`)
+
+	value := findNode(t, tree, "greeting")["value"].(map[string]interface{})
+	require.Equal(t, "TemplateExpression", value["type"])
+	parts := value["parts"].([]interface{})
+	require.Len(t, parts, 2)
+
+	join := parts[1].(map[string]interface{})
+	assert.Equal(t, "TemplateJoinExpression", join["type"])
+	assert.Equal(t, "ForExpression", join["tuple"].(map[string]interface{})["type"])
+}
+
+func TestTemplateExpressionLiteralText(t *testing.T) {
+	t.Parallel()
+
+	tree := generateProgramJSON(t, `
+config name "string" {}
+
+greeting = "hello ${name}!"
+`)
+
+	value := findNode(t, tree, "greeting")["value"].(map[string]interface{})
+	require.Equal(t, "TemplateExpression", value["type"])
+	parts := value["parts"].([]interface{})
+	require.Len(t, parts, 3)
+
+	assert.Equal(t, "hello ", parts[0].(map[string]interface{})["literalText"])
+	assert.NotContains(t, parts[1].(map[string]interface{}), "literalText")
+	assert.Equal(t, "ScopeTraversalExpression", parts[1].(map[string]interface{})["type"])
+	assert.Equal(t, "!", parts[2].(map[string]interface{})["literalText"])
+}
+
+func TestExpressionToJSON(t *testing.T) {
+	t.Parallel()
+
+	result, err := ExpressionToJSON(&model.BinaryOpExpression{
+		Operation:    hclsyntax.OpAdd,
+		LeftOperand:  &model.LiteralValueExpression{Value: cty.NumberIntVal(1)},
+		RightOperand: &model.LiteralValueExpression{Value: cty.NumberIntVal(2)},
+	})
+	require.NoError(t, err)
+	requireJSONEq(t, `{
+		"type": "BinaryOpExpression",
+		"operation": "add",
+		"left": {"type": "LiteralValueExpression", "value": 1},
+		"right": {"type": "LiteralValueExpression", "value": 2}
+	}`, result)
+
+	result, err = ExpressionToJSON(nil)
+	assert.NoError(t, err)
+	assert.Nil(t, result)
+
+	_, err = ExpressionToJSON(&model.ErrorExpression{Message: "bad expression"})
+	assert.ErrorContains(t, err, "unsupported expression type *model.ErrorExpression was not serialized")
+}
+
+func TestLiteralValueExpressionCollections(t *testing.T) {
+	t.Parallel()
+
+	transform := func(value cty.Value) map[string]interface{} {
+		return (&generator{}).transformExpression(&model.LiteralValueExpression{Value: value})
+	}
+
+	requireJSONEq(t, `{"type":"LiteralValueExpression","value":["a","b"]}`,
+		transform(cty.TupleVal([]cty.Value{cty.StringVal("a"), cty.StringVal("b")})))
+
+	requireJSONEq(t, `{"type":"LiteralValueExpression","value":{"enabled":true,"count":3}}`,
+		transform(cty.ObjectVal(map[string]cty.Value{
+			"enabled": cty.True,
+			"count":   cty.NumberIntVal(3),
+		})))
+
+	requireJSONEq(t, `{"type":"LiteralValueExpression","value":{"names":["a",null],"weights":{"x":1.5}}}`,
+		transform(cty.ObjectVal(map[string]cty.Value{
+			"names":   cty.TupleVal([]cty.Value{cty.StringVal("a"), cty.NullVal(cty.String)}),
+			"weights": cty.MapVal(map[string]cty.Value{"x": cty.NumberFloatVal(1.5)}),
+		})))
+
+	unsupported := transform(cty.TupleVal([]cty.Value{cty.SetVal([]cty.Value{cty.StringVal("a")})}))
+	assert.Equal(t, "UnsupportedExpression", unsupported["type"])
+}
+
+func TestGenerateProject(t *testing.T) {
+	t.Parallel()
+
+	program, diags := parseAndBindProgram(t, `output greeting {
+	value = "hello"
+}
+`, "program.pp")
+	require.False(t, diags.HasErrors(), "failed to bind program: %v", diags)
+
+	directory := t.TempDir()
+	project := workspace.Project{Name: "json-project"}
+	require.NoError(t, GenerateProject(directory, project, program))
+
+	programJSON, err := os.ReadFile(filepath.Join(directory, "program.json"))
+	require.NoError(t, err)
+	assert.Contains(t, string(programJSON), `"greeting"`)
+
+	projectYAML, err := os.ReadFile(filepath.Join(directory, "Pulumi.yaml"))
+	require.NoError(t, err)
+	assert.Contains(t, string(projectYAML), "name: json-project")
+	assert.Contains(t, string(projectYAML), "runtime: json")
+}
+
+func TestGenerateProjectDirectory(t *testing.T) {
+	t.Parallel()
+
+	program, diags := parseAndBindProgram(t, `output greeting {
+	value = "hello"
+}
+`, "program.pp")
+	require.False(t, diags.HasErrors(), "failed to bind program: %v", diags)
+	project := workspace.Project{Name: "json-project"}
+
+	t.Run("Missing", func(t *testing.T) {
+		t.Parallel()
+
+		directory := filepath.Join(t.TempDir(), "nested", "output")
+		require.NoError(t, GenerateProject(directory, project, program))
+		assert.FileExists(t, filepath.Join(directory, "program.json"))
+	})
+
+	t.Run("FileInTheWay", func(t *testing.T) {
+		t.Parallel()
+
+		directory := filepath.Join(t.TempDir(), "output")
+		require.NoError(t, os.WriteFile(directory, nil, 0600))
+		err := GenerateProject(directory, project, program)
+		assert.EqualError(t, err, fmt.Sprintf("output path %q is not a directory", directory))
+	})
+}
+
+func TestGenerateProjectFileMode(t *testing.T) {
+	t.Parallel()
+
+	program, diags := parseAndBindProgram(t, `output greeting {
+	value = "hello"
+}
+`, "program.pp")
+	require.False(t, diags.HasErrors(), "failed to bind program: %v", diags)
+	project := workspace.Project{Name: "json-project"}
+
+	directory := t.TempDir()
+	require.NoError(t, GenerateProject(directory, project, program))
+	info, err := os.Stat(filepath.Join(directory, "program.json"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	directory = t.TempDir()
+	require.NoError(t, GenerateProjectWithOptions(directory, project, program, GenerateProjectOptions{FileMode: 0644}))
+	for _, filename := range []string{"program.json", "Pulumi.yaml"} {
+		info, err := os.Stat(filepath.Join(directory, filename))
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0644), info.Mode().Perm(), filename)
+	}
+}
+
+func TestGenerateProjectPlan(t *testing.T) {
+	t.Parallel()
+
+	program, diags := parseAndBindProgram(t, `output greeting {
+	value = "hello"
+}
+`, "program.pp")
+	require.False(t, diags.HasErrors(), "failed to bind program: %v", diags)
+	project := workspace.Project{Name: "json-project"}
+
+	directory := filepath.Join(t.TempDir(), "project")
+	plan, err := GenerateProjectPlan(directory, project, program)
+	require.NoError(t, err)
+
+	paths := make([]string, 0, len(plan))
+	for path := range plan {
+		paths = append(paths, path)
+	}
+	assert.ElementsMatch(t, []string{
+		filepath.Join(directory, "Pulumi.yaml"),
+		filepath.Join(directory, "program.json"),
+	}, paths)
+
+	_, err = os.Stat(directory)
+	assert.True(t, os.IsNotExist(err), "the plan must not create the output directory")
+
+	// Writing the project produces exactly the planned files.
+	require.NoError(t, GenerateProject(directory, project, program))
+	for path, data := range plan {
+		written, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, string(data), string(written), path)
+	}
+}
+
+func TestGenerateProjectSplit(t *testing.T) {
+	t.Parallel()
+
+	program, diags := parseAndBindProgram(t, `output greeting {
+	value = "hello"
+}
+`, "program.pp")
+	require.False(t, diags.HasErrors(), "failed to bind program: %v", diags)
+	project := workspace.Project{Name: "json-project"}
+	opts := GenerateProjectOptions{Program: GenerateProgramOptions{SplitMode: SplitPerKind}}
+
+	directory := filepath.Join(t.TempDir(), "project")
+	require.NoError(t, GenerateProjectWithOptions(directory, project, program, opts))
+
+	entries, err := os.ReadDir(directory)
+	require.NoError(t, err)
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	assert.ElementsMatch(t, []string{
+		"Pulumi.yaml", "config.json", "locals.json", "outputs.json", "packages.json", "resources.json",
+	}, names)
+
+	// The project is recorded alongside the packages.
+	packagesJSON, err := os.ReadFile(filepath.Join(directory, "packages.json"))
+	require.NoError(t, err)
+	assert.Contains(t, string(packagesJSON), `"json-project"`)
+}
+
+func TestProjectFilePathsEscape(t *testing.T) {
+	t.Parallel()
+
+	plan, err := projectFilePaths("out", map[string][]byte{"nested/../program.json": []byte("{}")})
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]byte{filepath.Join("out", "program.json"): []byte("{}")}, plan)
+
+	filenames := []string{
+		"../escape.json", "nested/../../escape.json", "/tmp/escape.json", "..", `..\escape.json`, `\tmp\escape.json`,
+	}
+	for _, filename := range filenames {
+		_, err := projectFilePaths("out", map[string][]byte{
+			"program.json": []byte("{}"),
+			filename:       []byte("{}"),
+		})
+		assert.EqualError(t, err, fmt.Sprintf("output file %q would be written outside of \"out\"", filename))
+	}
+}
+
+func TestTransformPackage(t *testing.T) {
+	t.Parallel()
+
+	version := semver.MustParse("1.2.3")
+	requireJSONEq(t, `{
+		"name": "custom",
+		"kind": "resource",
+		"version": "1.2.3",
+		"downloadURL": "https://example.com/plugins"
+	}`, transformPackage(&schema.Package{
+		Name:              "custom",
+		Version:           &version,
+		PluginDownloadURL: "https://example.com/plugins",
+	}))
+
+	requireJSONEq(t, `{"name":"random","kind":"resource","version":null,"downloadURL":""}`,
+		transformPackage(&schema.Package{Name: "random"}))
+}
+
+func TestPackageWithoutVersion(t *testing.T) {
+	t.Parallel()
+
+	version := semver.MustParse("1.0.0")
+	unversioned := &schema.Package{Name: "random"}
+	versioned := &schema.Package{Name: "random", Version: &version}
+	assert.True(t, packageLess(unversioned, versioned))
+	assert.False(t, packageLess(versioned, unversioned))
+	assert.False(t, packageLess(unversioned, unversioned))
+
+	programJSON, err := json.Marshal(map[string]interface{}{
+		"nodes":    []interface{}{},
+		"packages": []interface{}{transformPackage(unversioned)},
+	})
+	require.NoError(t, err)
+
+	parsed, err := ParseProgram(programJSON)
+	require.NoError(t, err)
+	require.Len(t, parsed.Packages, 1)
+	assert.Equal(t, "random", parsed.Packages[0].Name)
+	assert.Equal(t, "resource", parsed.Packages[0].Kind)
+	assert.Equal(t, "", parsed.Packages[0].Version)
+}
+
+func TestFormatVersion(t *testing.T) {
+	t.Parallel()
+
+	tree := generateProgramJSON(t, `output greeting {
+	value = "hello"
+}
+`)
+	assert.Equal(t, "4.0", FormatVersion)
+	assert.Equal(t, FormatVersion, tree["formatVersion"])
+}
+
+func TestLogicalName(t *testing.T) {
+	t.Parallel()
+
+	tree := generateProgramJSON(t, `
+resource pet "random:index/randomPet:RandomPet" {}
+
+resource otherPet "random:index/randomPet:RandomPet" {
+	__logicalName = "other-pet"
+}
+`)
+
+	assert.NotContains(t, findNode(t, tree, "pet"), "logicalName")
+	assert.Equal(t, "other-pet", findNode(t, tree, "otherPet")["logicalName"])
+}
+
+func TestNotImplemented(t *testing.T) {
+	t.Parallel()
+
+	// notImplemented is not a PCL builtin, so binding reports an unknown function but still produces the call.
+	program, _ := parseAndBindProgram(t, `output instanceType {
+	value = notImplemented("data.aws_instance.web.instance_type")
+}
+`, "program.pp")
+
+	files, diags, err := GenerateProgram(program)
+	require.NoError(t, err)
+	require.False(t, diags.HasErrors(), "failed to generate program: %v", diags)
+
+	var tree map[string]interface{}
+	require.NoError(t, json.Unmarshal(files["program.json"], &tree))
+	requireJSONEq(t, `{
+		"type": "NotImplemented",
+		"message": "data.aws_instance.web.instance_type"
+	}`, findNode(t, tree, "instanceType")["value"])
+
+	parsed, err := ParseProgram(files["program.json"])
+	require.NoError(t, err)
+	value := parsed.Nodes[0].(*OutputVariable).Value
+	assert.Equal(t, &NotImplemented{Message: "data.aws_instance.web.instance_type"}, value)
+}
+
+func TestResourceAttributeOrder(t *testing.T) {
+	t.Parallel()
+
+	tree := generateProgramJSON(t, `
+resource pet "random:index/randomPet:RandomPet" {
+	separator = "_"
+	prefix = "doggo"
+	length = 3
+}
+`)
+
+	pet := findNode(t, tree, "pet")
+	assert.Equal(t, []interface{}{"separator", "prefix", "length"}, pet["attributeOrder"])
+	assert.Len(t, pet["attributes"], 3)
+}
+
+func TestResourcePackageVersion(t *testing.T) {
+	t.Parallel()
+
+	program, diags := parseAndBindProgram(t, `resource pet "random:index/randomPet:RandomPet" {}
+`, "program.pp")
+	require.False(t, diags.HasErrors(), "failed to bind program: %v", diags)
+
+	files, _, err := GenerateProgram(program)
+	require.NoError(t, err)
+
+	parsed, err := ParseProgram(files["program.json"])
+	require.NoError(t, err)
+	pet := parsed.Nodes[0].(*Resource)
+	require.NotNil(t, pet.PackageVersion)
+	assert.Equal(t, "4.3.1", *pet.PackageVersion)
+
+	require.Len(t, parsed.Packages, 1)
+	assert.Equal(t, parsed.Packages[0].Version, *pet.PackageVersion)
+}
+
+func TestScopeTraversalRootKind(t *testing.T) {
+	t.Parallel()
+
+	tree := generateProgramJSON(t, `
+config prefix "string" {}
+resource pet "random:index/randomPet:RandomPet" {
+	prefix = prefix
+}
+greeting = "hello"
+
+output petId {
+	value = pet.id
+}
+output message {
+	value = greeting
+}
+output ids {
+	value = [for v in [pet.id]: v]
+}
+`)
+
+	rootKind := func(expr interface{}) interface{} {
+		return expr.(map[string]interface{})["rootKind"]
+	}
+	assert.Equal(t, "ConfigVariable", rootKind(findAttribute(t, findNode(t, tree, "pet"), "prefix")))
+	assert.Equal(t, "Resource", rootKind(findNode(t, tree, "petId")["value"]))
+	assert.Equal(t, "LocalVariable", rootKind(findNode(t, tree, "message")["value"]))
+	// For-expression variables are not nodes.
+	ids := findNode(t, tree, "ids")["value"].(map[string]interface{})
+	assert.Equal(t, "unknown", rootKind(ids["value"]))
+}
+
+func TestResourceIsComponent(t *testing.T) {
+	t.Parallel()
+
+	program, diags := parseAndBindProgram(t, `
+resource component "synthetic:resourceProperties:Res1" {}
+resource custom "synthetic:resourceProperties:Res2" {}
+`, "program.pp")
+	require.False(t, diags.HasErrors(), "failed to bind program: %v", diags)
+
+	files, _, err := GenerateProgram(program)
+	require.NoError(t, err)
+	parsed, err := ParseProgram(files["program.json"])
+	require.NoError(t, err)
+
+	isComponent := map[string]bool{}
+	for _, node := range parsed.Nodes {
+		resource := node.(*Resource)
+		isComponent[resource.Name] = resource.IsComponent
+	}
+	assert.Equal(t, map[string]bool{"component": true, "custom": false}, isComponent)
+}
+
+func TestResourceTokenParts(t *testing.T) {
+	t.Parallel()
+
+	program, diags := parseAndBindProgram(t, `
+resource bucket "aws:s3/bucket:Bucket" {}
+`, "program.pp")
+	require.False(t, diags.HasErrors(), "failed to bind program: %v", diags)
+
+	files, _, err := GenerateProgramWithOptions(program, GenerateProgramOptions{IncludeTokenParts: true})
+	require.NoError(t, err)
+	parsed, err := ParseProgram(files["program.json"])
+	require.NoError(t, err)
+
+	resource := parsed.Nodes[0].(*Resource)
+	require.NotNil(t, resource.TokenParts)
+	assert.Equal(t, resource.Token, *resource.TokenParts.Package+":"+*resource.TokenParts.Module+":"+
+		*resource.TokenParts.TypeName)
+	assert.Equal(t, "aws", *resource.TokenParts.Package)
+	assert.Equal(t, "Bucket", *resource.TokenParts.TypeName)
+
+	// Walk does not mistake token parts for nodes.
+	var tree map[string]interface{}
+	require.NoError(t, json.Unmarshal(files["program.json"], &tree))
+	var visited []interface{}
+	Walk(tree, func(node map[string]interface{}) {
+		visited = append(visited, node["type"])
+	})
+	assert.Equal(t, []interface{}{"Resource"}, visited)
+
+	assert.Equal(t, map[string]interface{}{"package": "aws", "module": "ec2/instance", "typeName": "Instance"},
+		tokenParts("aws:ec2/instance:Instance"))
+	for _, token := range []string{"", "aws", "aws:Instance", ":ec2:", "a:b:c:d"} {
+		assert.Equal(t, map[string]interface{}{"package": nil, "module": nil, "typeName": nil}, tokenParts(token),
+			token)
+	}
+
+	files, _, err = GenerateProgram(program)
+	require.NoError(t, err)
+	assert.NotContains(t, string(files["program.json"]), "tokenParts")
+}
+
+func TestGenerateProgramSourceIndex(t *testing.T) {
+	t.Parallel()
+
+	// The nodes are declared in the reverse of their dependency order, so they are not emitted in source order.
+	program, diags := parseAndBindProgram(t, `
+output id {
+	value = pet.id
+}
+resource pet "random:index/randomPet:RandomPet" {
+	prefix = prefix
+}
+prefix = "${name}-"
+config name "string" {}
+`, "program.pp")
+	require.False(t, diags.HasErrors(), "failed to bind program: %v", diags)
+
+	files, _, err := GenerateProgramWithOptions(program, GenerateProgramOptions{IncludeRanges: true})
+	require.NoError(t, err)
+	parsed, err := ParseProgram(files["program.json"])
+	require.NoError(t, err)
+	require.Len(t, parsed.Nodes, 4)
+
+	type indexed struct {
+		name        string
+		sourceIndex int
+		offset      int
+	}
+	var nodes []indexed
+	for _, node := range parsed.Nodes {
+		switch node := node.(type) {
+		case *Resource:
+			nodes = append(nodes, indexed{node.Name, node.SourceIndex, node.Range.Start.Byte})
+		case *OutputVariable:
+			nodes = append(nodes, indexed{node.Name, node.SourceIndex, node.Range.Start.Byte})
+		case *LocalVariable:
+			nodes = append(nodes, indexed{node.Name, node.SourceIndex, node.Range.Start.Byte})
+		case *ConfigVariable:
+			nodes = append(nodes, indexed{node.Name, node.SourceIndex, node.Range.Start.Byte})
+		}
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].offset < nodes[j].offset })
+	for i, node := range nodes {
+		assert.Equal(t, i, node.sourceIndex, node.name)
+	}
+	assert.Equal(t, "id", nodes[0].name)
+}
+
+func TestGenerateProgramSourceFile(t *testing.T) {
+	t.Parallel()
+
+	program, diags := parseAndBindFiles(t, map[string]string{
+		"main.pp": `
+config name "string" {}
+resource pet "random:index/randomPet:RandomPet" {
+	prefix = prefix
+}
+`,
+		"outputs.pp": `
+prefix = "${name}-"
+output id {
+	value = pet.id
+}
+`,
+	})
+	require.False(t, diags.HasErrors(), "failed to bind program: %v", diags)
+
+	files, _, err := GenerateProgram(program)
+	require.NoError(t, err)
+	var tree map[string]interface{}
+	require.NoError(t, json.Unmarshal(files["program.json"], &tree))
+
+	assert.Equal(t, "main.pp", findNode(t, tree, "name")["sourceFile"])
+	assert.Equal(t, "main.pp", findNode(t, tree, "pet")["sourceFile"])
+	assert.Equal(t, "outputs.pp", findNode(t, tree, "prefix")["sourceFile"])
+	assert.Equal(t, "outputs.pp", findNode(t, tree, "id")["sourceFile"])
+
+	// Nodes are ordered by file and then by position within the file.
+	assert.Equal(t, 1.0, findNode(t, tree, "pet")["sourceIndex"])
+	assert.Equal(t, 2.0, findNode(t, tree, "prefix")["sourceIndex"])
+}
+
+func TestGenerateProgramGroupByPackage(t *testing.T) {
+	t.Parallel()
+
+	program, diags := parseAndBindProgram(t, `
+config name "string" {}
+resource bucket "aws:s3/bucket:Bucket" {}
+resource storage "google-native:storage/v1:Bucket" {
+	name = name
+}
+resource logs "aws:s3/bucket:Bucket" {}
+output bucketName {
+	value = bucket.id
+}
+`, "program.pp")
+	require.False(t, diags.HasErrors(), "failed to bind program: %v", diags)
+
+	files, _, err := GenerateProgramWithOptions(program, GenerateProgramOptions{GroupByPackage: true})
+	require.NoError(t, err)
+	parsed, err := ParseProgram(files["program.json"])
+	require.NoError(t, err)
+
+	names := func(nodes []Node) []string {
+		var names []string
+		for _, node := range nodes {
+			switch node := node.(type) {
+			case *Resource:
+				names = append(names, node.Name)
+			case *ConfigVariable:
+				names = append(names, node.Name)
+			case *OutputVariable:
+				names = append(names, node.Name)
+			}
+		}
+		sort.Strings(names)
+		return names
+	}
+	assert.Equal(t, []string{"bucketName", "name"}, names(parsed.Nodes))
+	require.Len(t, parsed.Resources, 2)
+	assert.Equal(t, []string{"bucket", "logs"}, names(parsed.Resources["aws"]))
+	assert.Equal(t, []string{"storage"}, names(parsed.Resources["google-native"]))
+
+	// GeneratePCL restores the grouped resources.
+	source, _, err := GeneratePCL(files["program.json"])
+	require.NoError(t, err)
+	assert.Contains(t, source, `resource storage "google-native:storage/v1:Bucket"`)
+	assert.Less(t, strings.Index(source, "resource bucket"), strings.Index(source, "resource logs"))
+
+	files, _, err = GenerateProgram(program)
+	require.NoError(t, err)
+	parsed, err = ParseProgram(files["program.json"])
+	require.NoError(t, err)
+	assert.Len(t, parsed.Nodes, 5)
+	assert.Nil(t, parsed.Resources)
+
+	_, _, err = GenerateProgramWithOptions(program, GenerateProgramOptions{GroupByPackage: true, Format: JSONLines})
+	assert.Error(t, err)
+}
+
+func TestNodeSafeName(t *testing.T) {
+	t.Parallel()
+
+	tree := generateProgramJSON(t, `
+resource logs "aws:s3/bucket:Bucket" {
+	__logicalName = "my bucket/logs"
+}
+resource plain "aws:s3/bucket:Bucket" {
+	__logicalName = "plain-bucket"
+}
+`)
+	logs := findNode(t, tree, "logs")
+	assert.Equal(t, "my bucket/logs", logs["logicalName"])
+	assert.Equal(t, "my_20bucket_2flogs", logs["safeName"])
+	assert.Equal(t, "plain-bucket", findNode(t, tree, "plain")["safeName"])
+
+	for _, name := range []string{"my bucket/logs", "my_bucket_logs", "ünïcode", ""} {
+		unescaped, err := UnescapeSafeName(SafeName(name))
+		require.NoError(t, err)
+		assert.Equal(t, name, unescaped)
+	}
+	assert.NotEqual(t, SafeName("a b"), SafeName("a_b"))
+
+	_, err := UnescapeSafeName("bad_2")
+	assert.Error(t, err)
+	_, err = UnescapeSafeName("bad_zz")
+	assert.Error(t, err)
+}
+
+func TestGenerateProgramOmitEmpty(t *testing.T) {
+	t.Parallel()
+
+	program, diags := parseAndBindProgram(t, `
+resource bucket "aws:s3/bucket:Bucket" {}
+resource tagged "aws:s3/bucket:Bucket" {
+	tags = { owner = "me" }
+}
+output dir {
+	value = cwd()
+}
+`, "program.pp")
+	require.False(t, diags.HasErrors(), "failed to bind program: %v", diags)
+
+	files, _, err := GenerateProgramWithOptions(program, GenerateProgramOptions{OmitEmpty: true})
+	require.NoError(t, err)
+	var tree map[string]interface{}
+	require.NoError(t, json.Unmarshal(files["program.json"], &tree))
+
+	bucket := findNode(t, tree, "bucket")
+	assert.NotContains(t, bucket, "attributes")
+	assert.NotContains(t, bucket, "attributeOrder")
+	assert.Contains(t, findNode(t, tree, "tagged"), "attributes")
+	call := findNode(t, tree, "dir")["value"].(map[string]interface{})
+	assert.NotContains(t, call, "args")
+	assert.Equal(t, 0.0, call["argCount"])
+	assert.Contains(t, tree, "packages")
+
+	diags, err = ValidateProgramJSON(files["program.json"])
+	require.NoError(t, err)
+	assert.Empty(t, diags)
+
+	tree = generateProgramJSON(t, `
+resource bucket "aws:s3/bucket:Bucket" {}
+`)
+	assert.Equal(t, map[string]interface{}{}, findNode(t, tree, "bucket")["attributes"])
+
+	program, diags = parseAndBindProgram(t, `
+config name "string" {}
+`, "program.pp")
+	require.False(t, diags.HasErrors(), "failed to bind program: %v", diags)
+	files, _, err = GenerateProgramWithOptions(program, GenerateProgramOptions{OmitEmpty: true})
+	require.NoError(t, err)
+	assert.NotContains(t, string(files["program.json"]), "packages")
+}
+
+func TestProgramHash(t *testing.T) {
+	t.Parallel()
+
+	hash := func(source string) string {
+		program, diags := parseAndBindProgram(t, source, "program.pp")
+		require.False(t, diags.HasErrors(), "failed to bind program: %v", diags)
+		hash, err := ProgramHash(program)
+		require.NoError(t, err)
+		return hash
+	}
+
+	source := `
+config names "list(string)" {}
+resource pets "random:index/randomPet:RandomPet" {
+	options { range = length(names) }
+	prefix = names[range.value]
+	keepers = { index = range.value, kind = "pet" }
+}
+output ids {
+	value = pets[*].id
+}
+`
+	first := hash(source)
+	assert.Len(t, first, 64)
+	assert.Equal(t, first, hash(source))
+	assert.NotEqual(t, first, hash(strings.Replace(source, `"pet"`, `"dog"`, 1)))
+}
+
+func TestObjectConsKeyEnumType(t *testing.T) {
+	t.Parallel()
+
+	tree := generateProgramJSON(t, `
+resource level "google-native:accesscontextmanager/v1:AccessLevel" {
+	accessPolicyId = "policy"
+	basic = {
+		combiningFunction = "OR"
+		conditions = []
+	}
+}
+`)
+
+	basic := findAttribute(t, findNode(t, tree, "level"), "basic").(map[string]interface{})
+	keyEnumTypes := map[string]interface{}{}
+	for _, property := range basic["properties"].([]interface{}) {
+		property := property.(map[string]interface{})
+		key := property["key"].(map[string]interface{})["value"].(string)
+		keyEnumTypes[key] = property["keyEnumType"]
+	}
+	assert.Equal(t, map[string]interface{}{
+		"combiningFunction": "google-native:accesscontextmanager/v1:BasicLevelCombiningFunction",
+		"conditions":        nil,
+	}, keyEnumTypes)
+}
+
+func TestOutputVariableExported(t *testing.T) {
+	t.Parallel()
+
+	tree := generateProgramJSON(t, `
+config name "string" {}
+greeting = "hello ${name}"
+output message {
+	value = greeting
+}
+`)
+
+	assert.Equal(t, true, findNode(t, tree, "message")["exported"])
+	assert.NotContains(t, findNode(t, tree, "greeting"), "exported")
+	assert.NotContains(t, findNode(t, tree, "name"), "exported")
+}
+
+func TestAssetAndArchiveExpressions(t *testing.T) {
+	t.Parallel()
+
+	tree := generateProgramJSON(t, `
+config dir "string" {}
+file = fileAsset("./index.html")
+remote = remoteAsset("https://example.com/index.html")
+text = stringAsset("<html></html>")
+archive = fileArchive("./site")
+computed = fileArchive("${dir}/site")
+`)
+
+	str := func(value string) string {
+		return fmt.Sprintf(`{"type": "TemplateExpression", "parts": [
+			{"type": "LiteralValueExpression", "value": %[1]q, "literalText": %[1]q}
+		]}`, value)
+	}
+	requireJSONEq(t, `{"type": "Asset", "kind": "file", "path": "./index.html", "argument": `+str("./index.html")+`}`,
+		findNode(t, tree, "file")["value"])
+	requireJSONEq(t, `{
+		"type": "Asset",
+		"kind": "remote",
+		"path": "https://example.com/index.html",
+		"argument": `+str("https://example.com/index.html")+`
+	}`, findNode(t, tree, "remote")["value"])
+	requireJSONEq(t, `{"type": "Asset", "kind": "string", "text": "<html></html>", "argument": `+str("<html></html>")+`}`,
+		findNode(t, tree, "text")["value"])
+	requireJSONEq(t, `{"type": "Archive", "kind": "file", "path": "./site", "argument": `+str("./site")+`}`,
+		findNode(t, tree, "archive")["value"])
+
+	computed := findNode(t, tree, "computed")["value"].(map[string]interface{})
+	assert.Equal(t, "Archive", computed["type"])
+	assert.Nil(t, computed["path"])
+	assert.Equal(t, "TemplateExpression", computed["argument"].(map[string]interface{})["type"])
+}
+
+func TestGenerateProgramInlineLocals(t *testing.T) {
+	t.Parallel()
+
+	program, diags := parseAndBindProgram(t, `
+config prefix "string" {}
+
+greeting = "hello ${prefix}"
+tags = { name = greeting }
+
+output message {
+	value = greeting
+}
+
+output tagName {
+	value = tags.name
+}
+`, "program.pp")
+	require.False(t, diags.HasErrors(), "failed to bind program: %v", diags)
+
+	files, diags, err := GenerateProgramWithOptions(program, GenerateProgramOptions{InlineLocals: true})
+	require.NoError(t, err)
+	assert.Empty(t, diags)
+
+	var tree map[string]interface{}
+	require.NoError(t, json.Unmarshal(files["program.json"], &tree))
+
+	greeting := `{
+		"type": "TemplateExpression",
+		"parts": [
+			{"type": "LiteralValueExpression", "value": "hello ", "literalText": "hello "},
+			{"type": "ScopeTraversalExpression", "rootName": "prefix", "rootKind": "ConfigVariable",
+				"traversal": [{"type": "TraverseRoot", "name": "prefix"}]}
+		]
+	}`
+	requireJSONEq(t, greeting, findNode(t, tree, "message")["value"])
+	requireJSONEq(t, `{
+		"type": "RelativeTraversalExpression",
+		"source": {
+			"type": "ObjectConsExpression",
+			"objectKind": "object",
+			"properties": [{
+				"key": {"type": "LiteralValueExpression", "value": "name"},
+				"value": `+greeting+`,
+				"type": {"kind": "string"}
+			}]
+		},
+		"traversal": [{"type": "TraverseAttr", "name": "name"}]
+	}`, findNode(t, tree, "tagName")["value"])
+
+	// The local variables themselves are still emitted.
+	requireJSONEq(t, greeting, findNode(t, tree, "greeting")["value"])
+}
+
+func TestGenerateProgramInlineLocalsCycle(t *testing.T) {
+	t.Parallel()
+
+	program, diags := parseAndBindProgram(t, `
+first = second
+second = 1
+`, "program.pp")
+	require.False(t, diags.HasErrors(), "failed to bind program: %v", diags)
+
+	// The binder rejects cycles, so close the loop by hand.
+	var first, second *pcl.LocalVariable
+	for _, node := range program.Nodes {
+		if local, ok := node.(*pcl.LocalVariable); ok {
+			switch local.Name() {
+			case "first":
+				first = local
+			case "second":
+				second = local
+			}
+		}
+	}
+	require.NotNil(t, first)
+	require.NotNil(t, second)
+	second.Definition.Value = first.Definition.Value
+	first.Definition.Value.(*model.ScopeTraversalExpression).Parts[0] = first
+
+	_, diags, err := GenerateProgramWithOptions(program, GenerateProgramOptions{InlineLocals: true})
+	require.NoError(t, err)
+	require.True(t, diags.HasErrors())
+	assert.Contains(t, diags.Error(), "local variable first refers to itself and cannot be inlined")
+}
+
+func TestOutputVariableSecretAndType(t *testing.T) {
+	t.Parallel()
+
+	tree := generateProgramJSON(t, `
+config names "list(string)" {}
+
+resource credentials "kubernetes:core/v1:Secret" {
+	stringData = { password = "hunter2" }
+}
+
+output token {
+	value = secret("abc")
+}
+
+output credentialData {
+	value = credentials.data
+}
+
+output count "int" {
+	value = length(names)
+}
+`)
+
+	token := findNode(t, tree, "token")
+	assert.Equal(t, true, token["secret"])
+	assert.Equal(t, map[string]interface{}{"kind": "dynamic"}, token["outputType"])
+
+	assert.Equal(t, true, findNode(t, tree, "credentialData")["secret"])
+
+	count := findNode(t, tree, "count")
+	assert.Equal(t, false, count["secret"])
+	assert.Equal(t, map[string]interface{}{"kind": "int"}, count["outputType"])
+}
+
+func TestGenerateProgramEmpty(t *testing.T) {
+	t.Parallel()
+
+	program, diags := parseAndBindProgram(t, "", "program.pp")
+	require.False(t, diags.HasErrors(), "failed to bind program: %v", diags)
+
+	files, diags, err := GenerateProgram(program)
+	require.NoError(t, err)
+	assert.Empty(t, diags)
+	assert.JSONEq(t, `{"formatVersion": "`+FormatVersion+`", "nodes": [], "packages": []}`,
+		string(files["program.json"]))
+
+	files, diags, err = GenerateProgramWithOptions(program, GenerateProgramOptions{ErrorOnEmpty: true})
+	require.NoError(t, err)
+	assert.Nil(t, files)
+	require.True(t, diags.HasErrors())
+	assert.Equal(t, "json-codegen: program has no resources, variables, or outputs", diags[0].Summary)
+}
+
+func TestGenerateYAML(t *testing.T) {
+	t.Parallel()
+
+	program, diags := parseAndBindProgram(t, `
+config names "list(string)" {
+	default = ["a", "1"]
+}
+
+resource pet "random:index/randomPet:RandomPet" {
+	prefix = names[1]
+	length = 3
+	options {
+		protect = true
+	}
+}
+
+output ratio {
+	value = length(names) / 2.5
+}
+`, "program.pp")
+	require.False(t, diags.HasErrors(), "failed to bind program: %v", diags)
+
+	jsonFiles, _, err := GenerateProgram(program)
+	require.NoError(t, err)
+	yamlFiles, diags, err := GenerateYAML(program)
+	require.NoError(t, err)
+	assert.Empty(t, diags)
+	require.Len(t, yamlFiles, 1)
+
+	// Decode the YAML and re-encode it as JSON so that it can be compared with the JSON output.
+	var tree interface{}
+	require.NoError(t, yaml.Unmarshal(yamlFiles["program.yaml"], &tree))
+	yamlJSON, err := json.Marshal(tree)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(jsonFiles["program.json"]), string(yamlJSON))
+
+	// The output is deterministic.
+	again, _, err := GenerateYAML(program)
+	require.NoError(t, err)
+	assert.Equal(t, yamlFiles["program.yaml"], again["program.yaml"])
+}
+
+func TestCollectTokens(t *testing.T) {
+	t.Parallel()
+
+	program, diags := parseAndBindProgram(t, `
+resource pet "random:index/randomPet:RandomPet" {}
+resource otherPet "random:index/randomPet:RandomPet" {}
+resource id "random:index/randomId:RandomId" {
+	byteLength = 8
+}
+
+ami = invoke("aws:index:getAmi", { owners = ["137112412989"] })
+`, "program.pp")
+	require.False(t, diags.HasErrors(), "failed to bind program: %v", diags)
+
+	expected := []string{"aws::getAmi", "random::RandomId", "random::RandomPet"}
+	assert.Equal(t, expected, CollectTokens(program))
+
+	files, _, err := GenerateProgram(program)
+	require.NoError(t, err)
+	assert.NotContains(t, string(files["program.json"]), `"tokens"`)
+
+	files, _, err = GenerateProgramWithOptions(program, GenerateProgramOptions{IncludeTokens: true})
+	require.NoError(t, err)
+	parsed, err := ParseProgram(files["program.json"])
+	require.NoError(t, err)
+	assert.Equal(t, expected, parsed.Tokens)
+}
+
+func TestGenerateProgramResolveDependsOn(t *testing.T) {
+	t.Parallel()
+
+	program, diags := parseAndBindProgram(t, `
+resource first "random:index/randomPet:RandomPet" {
+	__logicalName = "first-pet"
+}
+
+resource second "random:index/randomPet:RandomPet" {
+	options {
+		dependsOn = [first, length(first.id) > 0 ? first : first]
+	}
+}
+`, "program.pp")
+	require.False(t, diags.HasErrors(), "failed to bind program: %v", diags)
+
+	files, diags, err := GenerateProgramWithOptions(program, GenerateProgramOptions{ResolveDependsOn: true})
+	require.NoError(t, err)
+	require.Len(t, diags, 1)
+	assert.Equal(t, hcl.DiagWarning, diags[0].Severity)
+	assert.Equal(t, "json-codegen: dependsOn entry does not refer directly to a node and was not resolved",
+		diags[0].Summary)
+
+	parsed, err := ParseProgram(files["program.json"])
+	require.NoError(t, err)
+	var second *Resource
+	for _, node := range parsed.Nodes {
+		if resource, ok := node.(*Resource); ok && resource.Name == "second" {
+			second = resource
+		}
+	}
+	require.NotNil(t, second)
+	require.Len(t, second.Options.DependsOn, 2)
+	assert.Equal(t, &NodeReference{ID: "Resource::first-pet"}, second.Options.DependsOn[0])
+	assert.IsType(t, &ConditionalExpression{}, second.Options.DependsOn[1])
+
+	// Without the option, dependsOn entries are emitted as expressions.
+	files, _, err = GenerateProgram(program)
+	require.NoError(t, err)
+	assert.NotContains(t, string(files["program.json"]), "NodeReference")
+}
+
+func TestGenerateProgramResolveDependsOnIndexed(t *testing.T) {
+	t.Parallel()
+
+	program, diags := parseAndBindProgram(t, `
+resource many "random:index/randomPet:RandomPet" {
+	options {
+		range = 2
+	}
+}
+
+resource other "random:index/randomPet:RandomPet" {
+	options {
+		dependsOn = [many[0], many[1]]
+	}
+}
+`, "program.pp")
+	require.False(t, diags.HasErrors(), "failed to bind program: %v", diags)
+
+	files, diags, err := GenerateProgramWithOptions(program, GenerateProgramOptions{ResolveDependsOn: true})
+	require.NoError(t, err)
+	require.Len(t, diags, 2)
+	for _, diag := range diags {
+		assert.Equal(t, hcl.DiagWarning, diag.Severity)
+	}
+
+	// Indexed references select a specific instance, so they are kept as distinct expressions.
+	parsed, err := ParseProgram(files["program.json"])
+	require.NoError(t, err)
+	var other *Resource
+	for _, node := range parsed.Nodes {
+		if resource, ok := node.(*Resource); ok && resource.Name == "other" {
+			other = resource
+		}
+	}
+	require.NotNil(t, other)
+	require.Len(t, other.Options.DependsOn, 2)
+	assert.IsType(t, &ScopeTraversalExpression{}, other.Options.DependsOn[0])
+	assert.IsType(t, &ScopeTraversalExpression{}, other.Options.DependsOn[1])
+	assert.NotEqual(t, other.Options.DependsOn[0], other.Options.DependsOn[1])
+}
+
+func TestGenerateProgramOmitPackages(t *testing.T) {
+	t.Parallel()
+
+	program, diags := parseAndBindProgram(t, `resource pet "random:index/randomPet:RandomPet" {}
+`, "program.pp")
+	require.False(t, diags.HasErrors(), "failed to bind program: %v", diags)
+
+	files, _, err := GenerateProgram(program)
+	require.NoError(t, err)
+	assert.Contains(t, string(files["program.json"]), `"packages"`)
+
+	files, _, err = GenerateProgramWithOptions(program, GenerateProgramOptions{OmitPackages: true})
+	require.NoError(t, err)
+	var tree map[string]interface{}
+	require.NoError(t, json.Unmarshal(files["program.json"], &tree))
+	assert.NotContains(t, tree, "packages")
+	assert.Len(t, tree["nodes"], 1)
+
+	files, _, err = GenerateProgramWithOptions(program, GenerateProgramOptions{
+		OmitPackages: true,
+		SplitMode:    SplitPerKind,
+	})
+	require.NoError(t, err)
+	assert.NotContains(t, string(files["packages.json"]), `"packages"`)
+
+	files, _, err = GenerateProgramWithOptions(program, GenerateProgramOptions{OmitPackages: true, Format: JSONLines})
+	require.NoError(t, err)
+	assert.NotContains(t, string(files["program.jsonl"]), `"Package"`)
+}
+
+func TestBuildProgramTree(t *testing.T) {
+	t.Parallel()
+
+	program, diags := parseAndBindProgram(t, `resource pet "random:index/randomPet:RandomPet" {}
+`, "program.pp")
+	require.False(t, diags.HasErrors(), "failed to bind program: %v", diags)
+
+	tree, diags := BuildProgramTree(program)
+	assert.Empty(t, diags)
+	keys := make([]string, 0, len(tree))
+	for key := range tree {
+		keys = append(keys, key)
+	}
+	assert.ElementsMatch(t, []string{"formatVersion", "nodes", "packages"}, keys)
+	assert.Len(t, tree["nodes"], 1)
+
+	// GenerateProgram serializes the same tree.
+	files, _, err := GenerateProgram(program)
+	require.NoError(t, err)
+	treeJSON, err := json.Marshal(tree)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(treeJSON), string(files["program.json"]))
+
+	tree, _ = BuildProgramTreeWithOptions(program, GenerateProgramOptions{OmitPackages: true})
+	assert.NotContains(t, tree, "packages")
+}
+
+func TestGenerateProgramEmbedSchemas(t *testing.T) {
+	t.Parallel()
+
+	program, diags := parseAndBindProgram(t, `
+resource id "random:index/randomId:RandomId" {
+	byteLength = 8
+}
+
+ami = invoke("aws:index:getAmi", { owners = ["137112412989"] })
+`, "program.pp")
+	require.False(t, diags.HasErrors(), "failed to bind program: %v", diags)
+
+	files, _, err := GenerateProgram(program)
+	require.NoError(t, err)
+	assert.NotContains(t, string(files["program.json"]), `"schemas"`)
+
+	files, _, err = GenerateProgramWithOptions(program, GenerateProgramOptions{EmbedSchemas: true})
+	require.NoError(t, err)
+	parsed, err := ParseProgram(files["program.json"])
+	require.NoError(t, err)
+
+	id, ok := parsed.Schemas["random::RandomId"]
+	require.True(t, ok)
+	assert.Equal(t, "resource", id.Kind)
+	assert.Equal(t, PropertySchemaModel{
+		SchemaType:  "integer",
+		Required:    true,
+		Description: id.Inputs["byteLength"].Description,
+	}, id.Inputs["byteLength"])
+	assert.False(t, id.Inputs["prefix"].Required)
+	assert.Contains(t, id.Outputs, "hex")
+
+	ami, ok := parsed.Schemas["aws::getAmi"]
+	require.True(t, ok)
+	assert.Equal(t, "function", ami.Kind)
+	assert.Contains(t, ami.Inputs, "owners")
+
+	// Walk does not mistake property schemas for nodes.
+	var tree map[string]interface{}
+	require.NoError(t, json.Unmarshal(files["program.json"], &tree))
+	Walk(tree["schemas"].(map[string]interface{}), func(node map[string]interface{}) {
+		t.Errorf("unexpected node in schemas: %v", node)
+	})
+}
+
+func TestGenerateProgramIncludeKinds(t *testing.T) {
+	t.Parallel()
+
+	program, diags := parseAndBindProgram(t, `
+config prefix "string" {}
+
+resource pet "random:index/randomPet:RandomPet" {
+	prefix = prefix
+}
+
+name = pet.id
+
+output petId {
+	value = name
+}
+`, "program.pp")
+	require.False(t, diags.HasErrors(), "failed to bind program: %v", diags)
+
+	files, diags, err := GenerateProgramWithOptions(program, GenerateProgramOptions{
+		IncludeKinds: []string{"Resource"},
+	})
+	require.NoError(t, err)
+	assert.Empty(t, diags)
+
+	parsed, err := ParseProgram(files["program.json"])
+	require.NoError(t, err)
+	require.Len(t, parsed.Nodes, 1)
+	assert.Equal(t, "pet", parsed.Nodes[0].(*Resource).Name)
+	require.Len(t, parsed.Packages, 1)
+	assert.Equal(t, "random", parsed.Packages[0].Name)
+}
+
+func TestNodeIDs(t *testing.T) {
+	t.Parallel()
+
+	tree := generateProgramJSON(t, `
+config prefix "string" {}
+
+resource pet "random:index/randomPet:RandomPet" {
+	__logicalName = "my-pet"
+	prefix = prefix
+}
+
+petName = pet.id
+
+output petOutput {
+	__logicalName = "my-pet"
+	value = petName
+}
+`)
+
+	ids := map[interface{}]bool{}
+	for _, node := range tree["nodes"].([]interface{}) {
+		id := node.(map[string]interface{})["id"]
+		assert.False(t, ids[id], "duplicate id %v", id)
+		ids[id] = true
+	}
+	assert.Equal(t, map[interface{}]bool{
+		"ConfigVariable::prefix": true,
+		"Resource::my-pet":       true,
+		"LocalVariable::petName": true,
+		"OutputVariable::my-pet": true,
+	}, ids)
+}
+
+func TestFunctionCallArgCount(t *testing.T) {
+	t.Parallel()
+
+	tree := generateProgramJSON(t, `
+config names "list(string)" {}
+
+stackName = stack()
+joined = join(",", names)
+`)
+
+	stackName := findNode(t, tree, "stackName")["value"].(map[string]interface{})
+	assert.Equal(t, "stack", stackName["name"])
+	assert.Equal(t, []interface{}{}, stackName["args"])
+	assert.Equal(t, float64(0), stackName["argCount"])
+
+	joined := findNode(t, tree, "joined")["value"].(map[string]interface{})
+	assert.Len(t, joined["args"], 2)
+	assert.Equal(t, float64(2), joined["argCount"])
+}
+
+func TestFunctionCallHelperKind(t *testing.T) {
+	t.Parallel()
+
+	tree := generateProgramJSON(t, `
+config tags "map(string)" {}
+
+pairs = entries(tags)
+indices = range(3)
+joined = join(",", [])
+`)
+
+	pairs := findNode(t, tree, "pairs")["value"].(map[string]interface{})
+	assert.Equal(t, "entries", pairs["helperKind"])
+	indices := findNode(t, tree, "indices")["value"].(map[string]interface{})
+	assert.Equal(t, "range", indices["helperKind"])
+	joined := findNode(t, tree, "joined")["value"].(map[string]interface{})
+	assert.NotContains(t, joined, "helperKind")
+}
+
+func TestFunctionCallNamedArguments(t *testing.T) {
+	t.Parallel()
+
+	program, diags := parseAndBindProgram(t, `
+config names "list(string)" {}
+
+output joined {
+	value = join(",", names)
+}
+`, "program.pp")
+	require.False(t, diags.HasErrors(), "failed to bind program: %v", diags)
+
+	files, diags, err := GenerateProgramWithOptions(program, GenerateProgramOptions{NamedArguments: true})
+	require.NoError(t, err)
+	assert.Empty(t, diags)
+
+	var tree map[string]interface{}
+	require.NoError(t, json.Unmarshal(files["program.json"], &tree))
+	args := findNode(t, tree, "joined")["value"].(map[string]interface{})["args"]
+	requireJSONEq(t, `[
+		{
+			"type": "NamedArgument",
+			"name": "separator",
+			"value": {
+				"type": "TemplateExpression",
+				"parts": [{"type": "LiteralValueExpression", "value": ",", "literalText": ","}]
+			}
+		},
+		{
+			"type": "NamedArgument",
+			"name": "strings",
+			"value": {
+				"type": "ScopeTraversalExpression",
+				"rootName": "names",
+				"rootKind": "ConfigVariable",
+				"traversal": [{"type": "TraverseRoot", "name": "names"}]
+			}
+		}
+	]`, args)
+
+	// Without the option the arguments are positional.
+	tree = generateProgramJSON(t, `
+config names "list(string)" {}
+
+output joined {
+	value = join(",", names)
+}
+`)
+	args = findNode(t, tree, "joined")["value"].(map[string]interface{})["args"]
+	assert.Equal(t, "TemplateExpression", args.([]interface{})[0].(map[string]interface{})["type"])
+}
+
+func TestFunctionNameMapper(t *testing.T) {
+	t.Parallel()
+
+	program, diags := parseAndBindProgram(t, `
+config names "list(string)" {}
+
+output joined {
+	value = toJSON([join(",", names), length(names)])
+}
+`, "program.pp")
+	require.False(t, diags.HasErrors(), "failed to bind program: %v", diags)
+
+	files, diags, err := GenerateProgramWithOptions(program, GenerateProgramOptions{
+		FunctionNameMapper: strings.ToUpper,
+	})
+	require.NoError(t, err)
+	assert.Empty(t, diags)
+
+	var tree map[string]interface{}
+	require.NoError(t, json.Unmarshal(files["program.json"], &tree))
+
+	var names []interface{}
+	Walk(tree, func(node map[string]interface{}) {
+		if node["type"] == "FunctionCallExpression" {
+			names = append(names, node["name"])
+		}
+	})
+	assert.ElementsMatch(t, []interface{}{"TOJSON", "JOIN", "LENGTH"}, names)
+}
+
+func TestArgumentName(t *testing.T) {
+	t.Parallel()
+
+	signature := model.StaticFunctionSignature{
+		Parameters:       []model.Parameter{{Name: "first"}, {}},
+		VarargsParameter: &model.Parameter{Name: "rest"},
+	}
+	assert.Equal(t, "first", argumentName(signature, 0))
+	assert.Equal(t, "1", argumentName(signature, 1))
+	assert.Equal(t, "rest", argumentName(signature, 2))
+	assert.Equal(t, "0", argumentName(model.StaticFunctionSignature{}, 0))
+}
+
+func TestGenerateProgramProject(t *testing.T) {
+	t.Parallel()
+
+	program, diags := parseAndBindProgram(t, `output greeting {
+	value = "hello"
+}
+`, "program.pp")
+	require.False(t, diags.HasErrors(), "failed to bind program: %v", diags)
+
+	files, _, err := GenerateProgram(program)
+	require.NoError(t, err)
+	parsed, err := ParseProgram(files["program.json"])
+	require.NoError(t, err)
+	assert.Nil(t, parsed.Project)
+
+	description := "A friendly greeting"
+	project := &workspace.Project{
+		Name:        "json-project",
+		Description: &description,
+		Runtime:     workspace.NewProjectRuntimeInfo("json", nil),
+	}
+	files, _, err = GenerateProgramWithOptions(program, GenerateProgramOptions{Project: project})
+	require.NoError(t, err)
+	parsed, err = ParseProgram(files["program.json"])
+	require.NoError(t, err)
+	assert.Equal(t, &ProjectModel{
+		Name:        "json-project",
+		Description: "A friendly greeting",
+		Runtime:     "json",
+	}, parsed.Project)
+}
+
+func TestObjectConsExpressionDuplicateKeys(t *testing.T) {
+	t.Parallel()
+
+	tree := generateProgramJSON(t, `
+output values {
+	value = { a = 1, a = 2 }
+}
+`)
+
+	value := findNode(t, tree, "values")["value"].(map[string]interface{})
+	properties := value["properties"].([]interface{})
+	require.Len(t, properties, 2)
+	for i, expected := range []float64{1, 2} {
+		property := properties[i].(map[string]interface{})
+		assert.Equal(t, "a", property["key"].(map[string]interface{})["value"])
+		assert.Equal(t, expected, property["value"].(map[string]interface{})["value"])
+	}
+}
+
+func TestIndexExpressionConstantKey(t *testing.T) {
+	t.Parallel()
+
+	// A bare constant index such as arr[0] binds as a traversal whose TraverseIndex already records the index, so
+	// the constant keys here are parenthesized to keep them as index expressions.
+	tree := generateProgramJSON(t, `
+config arr "list(string)" {}
+config i "int" {}
+
+constant = arr[(0)]
+named = { name = arr }[("name")]
+dynamic = arr[i]
+`)
+
+	constant := findNode(t, tree, "constant")["value"].(map[string]interface{})
+	require.Equal(t, "IndexExpression", constant["type"])
+	assert.Equal(t, float64(0), constant["constantKey"])
+
+	named := findNode(t, tree, "named")["value"].(map[string]interface{})
+	require.Equal(t, "IndexExpression", named["type"])
+	assert.Equal(t, "name", named["constantKey"])
+
+	dynamic := findNode(t, tree, "dynamic")["value"].(map[string]interface{})
+	require.Equal(t, "IndexExpression", dynamic["type"])
+	assert.NotContains(t, dynamic, "constantKey")
+	assert.Equal(t, "ScopeTraversalExpression", dynamic["key"].(map[string]interface{})["type"])
+}
+
+func TestRelativeTraversalComplexSource(t *testing.T) {
+	t.Parallel()
+
+	tree := generateProgramJSON(t, `
+config csv "string" {}
+
+deviceName = invoke("aws:index:getAmi", { owners = ["137112412989"] }).blockDeviceMappings[0].deviceName
+firstName = [{ name = csv }][(0)].name
+`)
+
+	deviceName := findNode(t, tree, "deviceName")["value"].(map[string]interface{})
+	require.Equal(t, "RelativeTraversalExpression", deviceName["type"])
+	source := deviceName["source"].(map[string]interface{})
+	assert.Equal(t, "Invoke", source["type"])
+	assert.Equal(t, "aws::getAmi", source["token"])
+	assert.Contains(t, source["args"], "owners")
+	requireJSONEq(t, `[
+		{"type": "TraverseAttr", "name": "blockDeviceMappings"},
+		{"type": "TraverseIndex", "index": 0},
+		{"type": "TraverseAttr", "name": "deviceName"}
+	]`, deviceName["traversal"])
+
+	firstName := findNode(t, tree, "firstName")["value"].(map[string]interface{})
+	require.Equal(t, "RelativeTraversalExpression", firstName["type"])
+	index := firstName["source"].(map[string]interface{})
+	assert.Equal(t, "IndexExpression", index["type"])
+	assert.Equal(t, "TupleConsExpression", index["collection"].(map[string]interface{})["type"])
+	assert.Equal(t, float64(0), index["constantKey"])
+	requireJSONEq(t, `[{"type": "TraverseAttr", "name": "name"}]`, firstName["traversal"])
+}
+
+func TestObjectConsExpressionObjectKind(t *testing.T) {
+	t.Parallel()
+
+	tree := generateProgramJSON(t, `
+resource bucket "aws:s3/bucket:Bucket" {
+	tags = { name = "bucket" }
+	website = { indexDocument = "index.html" }
+}
+
+settings = { region = "us-east-1" }
+`)
+
+	bucket := findNode(t, tree, "bucket")
+	tags := findAttribute(t, bucket, "tags").(map[string]interface{})
+	assert.Equal(t, "map", tags["objectKind"])
+	website := findAttribute(t, bucket, "website").(map[string]interface{})
+	assert.Equal(t, "object", website["objectKind"])
+
+	// Objects that are not assigned to a schema type default to the object kind.
+	settings := findNode(t, tree, "settings")["value"].(map[string]interface{})
+	assert.Equal(t, "object", settings["objectKind"])
+}
+
+func TestObjectConsExpressionQuotedKeys(t *testing.T) {
+	t.Parallel()
+
+	tree := generateProgramJSON(t, `
+output provider {
+	value = { "region" = "us-east-1" }
+}
+`)
+
+	// Quoted keys bind as single-part templates. They are kept as-is, and their static value is used to look up the
+	// property type.
+	requireJSONEq(t, `{
+		"type": "ObjectConsExpression",
+		"objectKind": "object",
+		"properties": [{
+			"key": {
+				"type": "TemplateExpression",
+				"parts": [{"type": "LiteralValueExpression", "value": "region", "literalText": "region"}]
+			},
+			"value": {
+				"type": "TemplateExpression",
+				"parts": [{"type": "LiteralValueExpression", "value": "us-east-1", "literalText": "us-east-1"}]
+			},
+			"type": {"kind": "string"}
+		}]
+	}`, findNode(t, tree, "provider")["value"])
+}
+
+func TestObjectConsExpressionPropertyTypes(t *testing.T) {
+	t.Parallel()
+
+	tree := generateProgramJSON(t, `
+config names "list(string)" {}
+
+resource pet "random:index/randomPet:RandomPet" {
+	keepers = {
+		first = names[0]
+		count = length(names)
+		enabled = true
+	}
+}
+`)
+
+	keepers := findAttribute(t, findNode(t, tree, "pet"), "keepers").(map[string]interface{})
+	types := map[string]interface{}{}
+	for _, property := range keepers["properties"].([]interface{}) {
+		property := property.(map[string]interface{})
+		key := property["key"].(map[string]interface{})
+		types[key["value"].(string)] = property["type"]
+	}
+	requireJSONEq(t, `{
+		"first": {"kind": "string"},
+		"count": {"kind": "int"},
+		"enabled": {"kind": "bool"}
+	}`, types)
+}
+
+func TestTransformTraversal(t *testing.T) {
+	t.Parallel()
+
+	traversal := hcl.Traversal{
+		hcl.TraverseRoot{Name: "pets"},
+		hcl.TraverseSplat{},
+		hcl.TraverseAttr{Name: "tags"},
+		hcl.TraverseIndex{Key: cty.NumberIntVal(2)},
+	}
+	requireJSONEq(t, `[
+		{"type": "TraverseRoot", "name": "pets"},
+		{"type": "TraverseSplat"},
+		{"type": "TraverseAttr", "name": "tags"},
+		{"type": "TraverseIndex", "index": 2}
+	]`, transformTraversal(traversal))
+}
+
+func TestTraversalIndexKeys(t *testing.T) {
+	t.Parallel()
+
+	tree := generateProgramJSON(t, `
+config names "list(string)" {}
+config tags "map(string)" {}
+
+first = names[0]
+owner = tags["owner"]
+`)
+
+	requireJSONEq(t, `[
+		{"type": "TraverseRoot", "name": "names"},
+		{"type": "TraverseIndex", "index": 0}
+	]`, findNode(t, tree, "first")["value"].(map[string]interface{})["traversal"])
+	requireJSONEq(t, `[
+		{"type": "TraverseRoot", "name": "tags"},
+		{"type": "TraverseIndex", "key": "owner"}
+	]`, findNode(t, tree, "owner")["value"].(map[string]interface{})["traversal"])
+}
+
+func TestResourceAttributeSecrets(t *testing.T) {
+	t.Parallel()
+
+	tree := generateProgramJSON(t, `
+resource pet "random:index/randomPet:RandomPet" {
+	prefix = secret("hidden")
+	separator = "-"
+}
+
+resource credentials "kubernetes:core/v1:Secret" {
+	stringData = {
+		password = "hunter2"
+	}
+}
+`)
+
+	isSecret := func(node map[string]interface{}, name string) interface{} {
+		return node["attributes"].(map[string]interface{})[name].(map[string]interface{})["secret"]
+	}
+
+	pet := findNode(t, tree, "pet")
+	assert.Equal(t, true, isSecret(pet, "prefix"))
+	assert.Nil(t, isSecret(pet, "separator"))
+
+	credentials := findNode(t, tree, "credentials")
+	assert.Equal(t, true, isSecret(credentials, "stringData"))
+}
+
+func TestGenerateProgramJSONLines(t *testing.T) {
+	t.Parallel()
+
+	program, diags := parseAndBindProgram(t, `
+config prefix "string" {}
+
+resource pet "random:index/randomPet:RandomPet" {
+	prefix = prefix
+}
+
+name = pet.id
+
+output petId {
+	value = name
+}
+`, "program.pp")
+	require.False(t, diags.HasErrors(), "failed to bind program: %v", diags)
+
+	files, diags, err := GenerateProgramWithOptions(program, GenerateProgramOptions{Format: JSONLines})
+	require.NoError(t, err)
+	assert.Empty(t, diags)
+	require.Len(t, files, 1)
+
+	lines := strings.Split(strings.TrimSuffix(string(files["program.jsonl"]), "\n"), "\n")
+	require.Len(t, lines, len(program.Nodes)+len(program.Packages()))
+
+	types := make([]interface{}, len(lines))
+	for i, line := range lines {
+		var value map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(line), &value), "line %d is not valid JSON", i)
+		types[i] = value["type"]
+	}
+	assert.ElementsMatch(t,
+		[]interface{}{"ConfigVariable", "Resource", "LocalVariable", "OutputVariable", "Package"}, types)
+	assert.Equal(t, "Package", types[len(types)-1])
+
+	_, _, err = GenerateProgramWithOptions(program, GenerateProgramOptions{Format: JSONLines, SplitMode: SplitPerKind})
+	assert.EqualError(t, err, "JSON Lines output cannot be split")
+}
+
+func TestGenerateProgramSplitPerKind(t *testing.T) {
+	t.Parallel()
+
+	program, diags := parseAndBindProgram(t, `
+config prefix "string" {}
+
+resource pet "random:index/randomPet:RandomPet" {
+	prefix = prefix
+}
+
+upper = "${prefix}-pet"
+
+output name {
+	value = pet.id
+}
+`, "program.pp")
+	require.False(t, diags.HasErrors(), "failed to bind program: %v", diags)
+
+	single, _, err := GenerateProgram(program)
+	require.NoError(t, err)
+	var expected map[string]interface{}
+	require.NoError(t, json.Unmarshal(single["program.json"], &expected))
+
+	split, _, err := GenerateProgramWithOptions(program, GenerateProgramOptions{SplitMode: SplitPerKind})
+	require.NoError(t, err)
+
+	filenames := make([]string, 0, len(split))
+	for filename := range split {
+		filenames = append(filenames, filename)
+	}
+	assert.ElementsMatch(t, []string{
+		"resources.json", "outputs.json", "locals.json", "config.json", "packages.json",
+	}, filenames)
+
+	var nodes []interface{}
+	for _, filename := range []string{"resources.json", "outputs.json", "locals.json", "config.json"} {
+		var file map[string]interface{}
+		require.NoError(t, json.Unmarshal(split[filename], &file))
+		assert.Equal(t, FormatVersion, file["formatVersion"])
+		require.Len(t, file["nodes"], 1, filename)
+		nodes = append(nodes, file["nodes"].([]interface{})...)
+	}
+	assert.ElementsMatch(t, expected["nodes"], nodes)
+
+	var packages map[string]interface{}
+	require.NoError(t, json.Unmarshal(split["packages.json"], &packages))
+	assert.Equal(t, expected["packages"], packages["packages"])
+}
+
+func TestFunctionCallSignature(t *testing.T) {
+	t.Parallel()
+
+	tree := generateProgramJSON(t, `
+config names "list(string)" {}
+
+count = length(names)
+`)
+
+	call := findNode(t, tree, "count")["value"].(map[string]interface{})
+	assert.Equal(t, "length", call["name"])
+	requireJSONEq(t, `{"kind":"int"}`, call["returnType"])
+	require.Len(t, call["parameterTypes"], 1)
+}
+
+func TestResourceOptionsInput(t *testing.T) {
+	t.Parallel()
+
+	// The schema for this resource has an input property named "options", which must not be confused with the
+	// resource options block.
+	tree := generateProgramJSON(t, `
+resource domain "aws-native:ec2:TransitGatewayMulticastDomain" {
+	transitGatewayId = "tgw-1234"
+	options = {
+		dnsSupport = "enable"
+	}
+	options {
+		protect = true
+	}
+}
+`)
+
+	domain := findNode(t, tree, "domain")
+	resourceOptions := domain["options"].(map[string]interface{})
+	requireJSONEq(t, `{"type": "LiteralValueExpression", "value": true}`, resourceOptions["protect"])
+
+	attributes := domain["attributes"].(map[string]interface{})
+	require.Len(t, attributes, 2)
+	options := attributes["options"].(map[string]interface{})
+	assert.Equal(t, "object", options["schemaType"])
+	assert.Equal(t, "ObjectConsExpression", options["value"].(map[string]interface{})["type"])
+}
+
+func TestGenerateProjectContextCanceled(t *testing.T) {
+	t.Parallel()
+
+	program, diags := parseAndBindProgram(t, `output greeting {
+	value = "hello"
+}
+`, "program.pp")
+	require.False(t, diags.HasErrors(), "failed to bind program: %v", diags)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	directory := t.TempDir()
+	err := GenerateProjectContext(ctx, directory, workspace.Project{Name: "json-project"}, program,
+		GenerateProjectOptions{})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.EqualError(t, err, "could not write output program: context canceled")
+
+	entries, err := os.ReadDir(directory)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
@@ -0,0 +1,884 @@
+// Copyright 2016-2022, Pulumi Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package json
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+)
+
+// ProgramModel is the typed form of a program.json document.
+type ProgramModel struct {
+	FormatVersion string                 `json:"formatVersion"`
+	Nodes         []Node                 `json:"nodes"`
+	Packages      []PackageModel         `json:"packages,omitempty"`
+	Project       *ProjectModel          `json:"project,omitempty"`
+	Tokens        []string               `json:"tokens,omitempty"`
+	Schemas       map[string]SchemaModel `json:"schemas,omitempty"`
+
+	// Resources holds the program's resources grouped by package if the program was generated with GroupByPackage
+	// set. Nodes then holds only the program's other nodes.
+	Resources map[string][]Node `json:"resources,omitempty"`
+}
+
+// SchemaModel is the typed form of the schema of a resource or invoke used by a program.
+type SchemaModel struct {
+	// Kind is "resource" or "function".
+	Kind    string                         `json:"kind"`
+	Inputs  map[string]PropertySchemaModel `json:"inputs"`
+	Outputs map[string]PropertySchemaModel `json:"outputs"`
+}
+
+// PropertySchemaModel is the typed form of the schema of a single resource or invoke property.
+type PropertySchemaModel struct {
+	SchemaType  string `json:"schemaType"`
+	Required    bool   `json:"required"`
+	Secret      bool   `json:"secret"`
+	Description string `json:"description"`
+}
+
+// ProjectModel is the typed form of the metadata of the project that contains a program.
+type ProjectModel struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Runtime     string `json:"runtime"`
+}
+
+// PackageModel describes a package referenced by a program.
+type PackageModel struct {
+	Name string `json:"name"`
+	// Kind is the kind of plugin that provides the package, e.g. "resource".
+	Kind        string `json:"kind"`
+	Version     string `json:"version"`
+	DownloadURL string `json:"downloadURL"`
+}
+
+// Node is implemented by the typed forms of the nodes in a program.json document. A node's LogicalName is empty if it
+// is the same as the node's Name. A node's ID is formed from its kind and logical name, e.g. "Resource::my-bucket",
+// and its SafeName is its logical name escaped by SafeName.
+// A node's SourceIndex is its position in the order in which the program's nodes were declared, and its SourceFile is
+// the name of the file that declares it.
+type Node interface {
+	// NodeType returns the value of the node's "type" discriminator.
+	NodeType() string
+}
+
+// Expression is implemented by the typed forms of the expressions in a program.json document.
+type Expression interface {
+	// ExpressionType returns the value of the expression's "type" discriminator.
+	ExpressionType() string
+}
+
+// Resource is the typed form of a Resource node.
+type Resource struct {
+	Ranged
+
+	ID          string `json:"id"`
+	SafeName    string `json:"safeName"`
+	SourceIndex int    `json:"sourceIndex"`
+	SourceFile  string `json:"sourceFile"`
+	Name        string `json:"name"`
+	LogicalName string `json:"logicalName,omitempty"`
+	Token       string `json:"token"`
+	// PackageVersion is the version of the package that Token was bound against, if known.
+	PackageVersion *string `json:"packageVersion"`
+	// TokenParts holds the parts of Token, if they were requested.
+	TokenParts *TokenParts `json:"tokenParts,omitempty"`
+	// IsComponent is true if the resource's schema marks it as a component resource.
+	IsComponent bool                         `json:"isComponent"`
+	Attributes  map[string]ResourceAttribute `json:"attributes,omitempty"`
+	// AttributeOrder lists the names of the attributes in source order.
+	AttributeOrder []string         `json:"attributeOrder,omitempty"`
+	Options        *ResourceOptions `json:"options"`
+}
+
+// TokenParts is the typed form of the parts of a resource token. The parts of a malformed token are nil.
+type TokenParts struct {
+	Package  *string `json:"package"`
+	Module   *string `json:"module"`
+	TypeName *string `json:"typeName"`
+}
+
+// ResourceAttribute is the typed form of a resource input attribute.
+type ResourceAttribute struct {
+	Value      Expression `json:"value"`
+	SchemaType *string    `json:"schemaType"`
+	Secret     bool       `json:"secret,omitempty"`
+}
+
+// ResourceOptions is the typed form of a resource's options.
+type ResourceOptions struct {
+	Range             *ResourceRange `json:"range"`
+	Protect           Expression     `json:"protect"`
+	DependsOn         []Expression   `json:"dependsOn"`
+	Provider          Expression     `json:"provider"`
+	Parent            Expression     `json:"parent"`
+	IgnoreChanges     []Expression   `json:"ignoreChanges"`
+	Version           Expression     `json:"version"`
+	PluginDownloadURL Expression     `json:"pluginDownloadURL"`
+	Aliases           []Alias        `json:"aliases"`
+}
+
+// Alias is the typed form of a resource alias. Aliases that were written as objects hold the value of each of their
+// fields, and other aliases, such as URNs, are held in Value.
+type Alias struct {
+	Name    Expression `json:"name,omitempty"`
+	Type    Expression `json:"type,omitempty"`
+	Parent  Expression `json:"parent,omitempty"`
+	Stack   Expression `json:"stack,omitempty"`
+	Project Expression `json:"project,omitempty"`
+	Value   Expression `json:"value,omitempty"`
+}
+
+// ResourceRange is the typed form of a resource's range option.
+type ResourceRange struct {
+	Expression Expression `json:"expression"`
+	IsCount    bool       `json:"isCount"`
+}
+
+// OutputVariable is the typed form of an OutputVariable node.
+type OutputVariable struct {
+	Ranged
+
+	ID          string     `json:"id"`
+	SafeName    string     `json:"safeName"`
+	SourceIndex int        `json:"sourceIndex"`
+	SourceFile  string     `json:"sourceFile"`
+	Name        string     `json:"name"`
+	LogicalName string     `json:"logicalName,omitempty"`
+	OutputType  *Type      `json:"outputType"`
+	Secret      bool       `json:"secret"`
+	Value       Expression `json:"value"`
+
+	// Exported is always true: every output variable is exported as a stack output.
+	Exported bool `json:"exported"`
+}
+
+// LocalVariable is the typed form of a LocalVariable node.
+type LocalVariable struct {
+	Ranged
+
+	ID          string     `json:"id"`
+	SafeName    string     `json:"safeName"`
+	SourceIndex int        `json:"sourceIndex"`
+	SourceFile  string     `json:"sourceFile"`
+	Name        string     `json:"name"`
+	LogicalName string     `json:"logicalName,omitempty"`
+	Value       Expression `json:"value"`
+}
+
+// ConfigVariable is the typed form of a ConfigVariable node.
+type ConfigVariable struct {
+	Ranged
+
+	ID           string     `json:"id"`
+	SafeName     string     `json:"safeName"`
+	SourceIndex  int        `json:"sourceIndex"`
+	SourceFile   string     `json:"sourceFile"`
+	Name         string     `json:"name"`
+	LogicalName  string     `json:"logicalName,omitempty"`
+	ConfigType   *Type      `json:"configType"`
+	DefaultValue Expression `json:"defaultValue"`
+	Description  string     `json:"description"`
+	Nullable     bool       `json:"nullable"`
+	// AllowedValues holds the values of the config variable's type if it is an enum.
+	AllowedValues []interface{} `json:"allowedValues,omitempty"`
+}
+
+func (*Resource) NodeType() string       { return "Resource" }
+func (*OutputVariable) NodeType() string { return "OutputVariable" }
+func (*LocalVariable) NodeType() string  { return "LocalVariable" }
+func (*ConfigVariable) NodeType() string { return "ConfigVariable" }
+
+// Ranged records the source range and source text of a node or expression. The range is only present if the program
+// was generated with IncludeRanges set, and the text only if it was generated with IncludeSourceText set.
+type Ranged struct {
+	Range      *SourceRange `json:"range,omitempty"`
+	SourceText string       `json:"sourceText,omitempty"`
+}
+
+// SourceRange is the typed form of a source range.
+type SourceRange struct {
+	Filename string    `json:"filename"`
+	Start    SourcePos `json:"start"`
+	End      SourcePos `json:"end"`
+}
+
+// SourcePos is the typed form of a position within a source file.
+type SourcePos struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+	Byte   int `json:"byte"`
+}
+
+// Type is the typed form of a serialized model type.
+type Type struct {
+	Kind         string           `json:"kind"`
+	Name         string           `json:"name,omitempty"`
+	Token        string           `json:"token,omitempty"`
+	ElementType  *Type            `json:"elementType,omitempty"`
+	ElementTypes []*Type          `json:"elementTypes,omitempty"`
+	Properties   map[string]*Type `json:"properties,omitempty"`
+}
+
+// Traverser is the typed form of a single part of a traversal.
+type Traverser struct {
+	Type  string      `json:"type"`
+	Name  string      `json:"name,omitempty"`
+	Index json.Number `json:"index,omitempty"`
+	Key   *string     `json:"key,omitempty"`
+}
+
+// LiteralValueExpression is the typed form of a LiteralValueExpression.
+type LiteralValueExpression struct {
+	Ranged
+
+	Value  interface{} `json:"value"`
+	IsNull bool        `json:"isNull,omitempty"`
+
+	// LiteralText is set on the literal text parts of a TemplateExpression.
+	LiteralText *string `json:"literalText,omitempty"`
+	// NumberMode is "string" if the value is a number that was emitted as a string. Such values are decoded as
+	// json.Number.
+	NumberMode string `json:"numberMode,omitempty"`
+}
+
+// UnmarshalJSON decodes a LiteralValueExpression, restoring numbers that were emitted as strings.
+func (expr *LiteralValueExpression) UnmarshalJSON(data []byte) error {
+	type literal LiteralValueExpression
+	if err := unmarshal(data, (*literal)(expr)); err != nil {
+		return err
+	}
+	if s, ok := expr.Value.(string); ok && expr.NumberMode == "string" {
+		expr.Value = json.Number(s)
+	}
+	return nil
+}
+
+// TemplateExpression is the typed form of a TemplateExpression.
+type TemplateExpression struct {
+	Ranged
+
+	Parts []Expression `json:"parts"`
+}
+
+// TemplateJoinExpression is the typed form of a TemplateJoinExpression.
+type TemplateJoinExpression struct {
+	Ranged
+
+	Tuple Expression `json:"tuple"`
+}
+
+// IndexExpression is the typed form of an IndexExpression.
+type IndexExpression struct {
+	Ranged
+
+	Collection Expression `json:"collection"`
+	Key        Expression `json:"key"`
+	// ConstantKey holds the value of Key if it is a literal number or string. Numbers are held as json.Number.
+	ConstantKey interface{} `json:"constantKey,omitempty"`
+}
+
+// ObjectConsExpression is the typed form of an ObjectConsExpression.
+type ObjectConsExpression struct {
+	Ranged
+
+	// ObjectKind is "map" if the object is assigned to a map type and "object" otherwise.
+	ObjectKind string               `json:"objectKind"`
+	Properties []ObjectConsProperty `json:"properties"`
+}
+
+// ObjectConsProperty is the typed form of a single key/value entry of an ObjectConsExpression.
+type ObjectConsProperty struct {
+	Key   Expression `json:"key"`
+	Value Expression `json:"value"`
+	Type  *Type      `json:"type,omitempty"`
+	// KeyEnumType is the token of the enum type of the key, if the key names an enum-typed property.
+	KeyEnumType string `json:"keyEnumType,omitempty"`
+}
+
+// TupleConsExpression is the typed form of a TupleConsExpression.
+type TupleConsExpression struct {
+	Ranged
+
+	Items []Expression `json:"items"`
+	// ElementType is set if every item has the same type, and ElementTypes holds the type of each item otherwise.
+	// Neither is set if any item is itself an object or tuple constructor.
+	ElementType  *Type   `json:"elementType,omitempty"`
+	ElementTypes []*Type `json:"elementTypes,omitempty"`
+}
+
+// FunctionCallExpression is the typed form of a FunctionCallExpression.
+type FunctionCallExpression struct {
+	Ranged
+
+	Name           string       `json:"name"`
+	Args           []Expression `json:"args,omitempty"`
+	ArgCount       int          `json:"argCount"`
+	ReturnType     *Type        `json:"returnType,omitempty"`
+	ParameterTypes []*Type      `json:"parameterTypes,omitempty"`
+
+	// HelperKind is set to the name of the function if it is a collection helper such as "entries" or "range".
+	HelperKind string `json:"helperKind,omitempty"`
+}
+
+// NamedArgument is the typed form of a function call argument that records the name of the parameter that receives
+// it. Function call arguments are only named if the NamedArguments option was set.
+type NamedArgument struct {
+	Ranged
+
+	Name  string     `json:"name"`
+	Value Expression `json:"value"`
+}
+
+// Invoke is the typed form of a call to the invoke intrinsic.
+type Invoke struct {
+	Ranged
+
+	Token      string                `json:"token"`
+	Args       map[string]Expression `json:"args,omitempty"`
+	Options    Expression            `json:"options"`
+	ReturnType *Type                 `json:"returnType,omitempty"`
+}
+
+// RelativeTraversalExpression is the typed form of a RelativeTraversalExpression.
+type RelativeTraversalExpression struct {
+	Ranged
+
+	Source    Expression  `json:"source"`
+	Traversal []Traverser `json:"traversal"`
+}
+
+// ScopeTraversalExpression is the typed form of a ScopeTraversalExpression.
+type ScopeTraversalExpression struct {
+	Ranged
+
+	RootName string `json:"rootName"`
+	// RootKind is the type of the node that the root refers to, e.g. "Resource", or "unknown" if the root is not a
+	// node.
+	RootKind  string      `json:"rootKind"`
+	Traversal []Traverser `json:"traversal"`
+}
+
+// BinaryOpExpression is the typed form of a BinaryOpExpression.
+type BinaryOpExpression struct {
+	Ranged
+
+	Operation string     `json:"operation"`
+	Left      Expression `json:"left"`
+	Right     Expression `json:"right"`
+}
+
+// UnaryOpExpression is the typed form of a UnaryOpExpression.
+type UnaryOpExpression struct {
+	Ranged
+
+	Operation string     `json:"operation"`
+	Operand   Expression `json:"operand"`
+}
+
+// ConditionalExpression is the typed form of a ConditionalExpression.
+type ConditionalExpression struct {
+	Ranged
+
+	Condition   Expression `json:"condition"`
+	TrueResult  Expression `json:"trueResult"`
+	FalseResult Expression `json:"falseResult"`
+	// ResultType is the type of the conditional's result, which is often a union of the types of its results.
+	ResultType *Type `json:"resultType"`
+}
+
+// ForExpression is the typed form of a ForExpression.
+type ForExpression struct {
+	Ranged
+
+	KeyVariable   *string    `json:"keyVariable"`
+	ValueVariable string     `json:"valueVariable"`
+	Collection    Expression `json:"collection"`
+	Key           Expression `json:"key"`
+	Value         Expression `json:"value"`
+	Condition     Expression `json:"condition"`
+	Group         bool       `json:"group"`
+}
+
+// SplatExpression is the typed form of a SplatExpression.
+type SplatExpression struct {
+	Ranged
+
+	Source Expression    `json:"source"`
+	Each   Expression    `json:"each"`
+	Item   SplatVariable `json:"item"`
+}
+
+// SplatVariable is the typed form of the synthetic variable bound by a SplatExpression.
+type SplatVariable struct {
+	Name string `json:"name"`
+}
+
+// AnonymousFunctionExpression is the typed form of an AnonymousFunctionExpression.
+type AnonymousFunctionExpression struct {
+	Ranged
+
+	Parameters []Parameter `json:"parameters"`
+	Body       Expression  `json:"body"`
+}
+
+// Parameter is the typed form of an anonymous function parameter.
+type Parameter struct {
+	Name string `json:"name"`
+}
+
+// Asset is the typed form of a call to the fileAsset, remoteAsset, or stringAsset builtin.
+type Asset struct {
+	Ranged
+
+	// Kind is "file", "remote", or "string".
+	Kind string `json:"kind"`
+	// Path holds the path of a file asset or the URI of a remote asset if it is a literal.
+	Path *string `json:"path,omitempty"`
+	// Text holds the text of a string asset if it is a literal.
+	Text     *string    `json:"text,omitempty"`
+	Argument Expression `json:"argument"`
+}
+
+// Archive is the typed form of a call to the fileArchive or remoteArchive builtin.
+type Archive struct {
+	Ranged
+
+	// Kind is "file" or "remote".
+	Kind string `json:"kind"`
+	// Path holds the path of a file archive or the URI of a remote archive if it is a literal.
+	Path     *string    `json:"path,omitempty"`
+	Argument Expression `json:"argument"`
+}
+
+// NodeReference is the typed form of a reference to another node by its ID. References are only emitted for the
+// dependsOn option of a resource, and only if the ResolveDependsOn option was set.
+type NodeReference struct {
+	Ranged
+
+	ID string `json:"id"`
+}
+
+// NullExpression is the typed form of the marker emitted for a missing resource attribute, output, or local variable
+// value.
+type NullExpression struct {
+	Ranged
+}
+
+// NotImplemented is the typed form of a construct that a converter marked as not implemented.
+type NotImplemented struct {
+	Ranged
+
+	Message string `json:"message"`
+}
+
+// UnsupportedExpression is the typed form of the marker emitted for expressions that could not be serialized.
+type UnsupportedExpression struct {
+	Ranged
+
+	ExprType string `json:"exprType"`
+	// Tokens holds the source text of the expression. It is not set for literals of unsupported types, which are
+	// described by ValueType instead.
+	Tokens    string `json:"tokens,omitempty"`
+	ValueType string `json:"valueType,omitempty"`
+}
+
+func (*LiteralValueExpression) ExpressionType() string      { return "LiteralValueExpression" }
+func (*TemplateExpression) ExpressionType() string          { return "TemplateExpression" }
+func (*TemplateJoinExpression) ExpressionType() string      { return "TemplateJoinExpression" }
+func (*IndexExpression) ExpressionType() string             { return "IndexExpression" }
+func (*ObjectConsExpression) ExpressionType() string        { return "ObjectConsExpression" }
+func (*TupleConsExpression) ExpressionType() string         { return "TupleConsExpression" }
+func (*FunctionCallExpression) ExpressionType() string      { return "FunctionCallExpression" }
+func (*NamedArgument) ExpressionType() string               { return "NamedArgument" }
+func (*Invoke) ExpressionType() string                      { return "Invoke" }
+func (*RelativeTraversalExpression) ExpressionType() string { return "RelativeTraversalExpression" }
+func (*ScopeTraversalExpression) ExpressionType() string    { return "ScopeTraversalExpression" }
+func (*BinaryOpExpression) ExpressionType() string          { return "BinaryOpExpression" }
+func (*UnaryOpExpression) ExpressionType() string           { return "UnaryOpExpression" }
+func (*ConditionalExpression) ExpressionType() string       { return "ConditionalExpression" }
+func (*ForExpression) ExpressionType() string               { return "ForExpression" }
+func (*SplatExpression) ExpressionType() string             { return "SplatExpression" }
+func (*AnonymousFunctionExpression) ExpressionType() string { return "AnonymousFunctionExpression" }
+func (*Asset) ExpressionType() string                       { return "Asset" }
+func (*Archive) ExpressionType() string                     { return "Archive" }
+func (*NodeReference) ExpressionType() string               { return "NodeReference" }
+func (*NullExpression) ExpressionType() string              { return "NullExpression" }
+func (*NotImplemented) ExpressionType() string              { return "NotImplemented" }
+func (*UnsupportedExpression) ExpressionType() string       { return "UnsupportedExpression" }
+
+// newNode returns a new, empty node for the given "type" discriminator.
+func newNode(typ string) (Node, bool) {
+	switch typ {
+	case "Resource":
+		return &Resource{}, true
+	case "OutputVariable":
+		return &OutputVariable{}, true
+	case "LocalVariable":
+		return &LocalVariable{}, true
+	case "ConfigVariable":
+		return &ConfigVariable{}, true
+	default:
+		return nil, false
+	}
+}
+
+// newExpression returns a new, empty expression for the given "type" discriminator.
+func newExpression(typ string) (Expression, bool) {
+	switch typ {
+	case "LiteralValueExpression":
+		return &LiteralValueExpression{}, true
+	case "TemplateExpression":
+		return &TemplateExpression{}, true
+	case "TemplateJoinExpression":
+		return &TemplateJoinExpression{}, true
+	case "IndexExpression":
+		return &IndexExpression{}, true
+	case "ObjectConsExpression":
+		return &ObjectConsExpression{}, true
+	case "TupleConsExpression":
+		return &TupleConsExpression{}, true
+	case "FunctionCallExpression":
+		return &FunctionCallExpression{}, true
+	case "NamedArgument":
+		return &NamedArgument{}, true
+	case "Invoke":
+		return &Invoke{}, true
+	case "RelativeTraversalExpression":
+		return &RelativeTraversalExpression{}, true
+	case "ScopeTraversalExpression":
+		return &ScopeTraversalExpression{}, true
+	case "BinaryOpExpression":
+		return &BinaryOpExpression{}, true
+	case "UnaryOpExpression":
+		return &UnaryOpExpression{}, true
+	case "ConditionalExpression":
+		return &ConditionalExpression{}, true
+	case "ForExpression":
+		return &ForExpression{}, true
+	case "SplatExpression":
+		return &SplatExpression{}, true
+	case "AnonymousFunctionExpression":
+		return &AnonymousFunctionExpression{}, true
+	case "Asset":
+		return &Asset{}, true
+	case "Archive":
+		return &Archive{}, true
+	case "NodeReference":
+		return &NodeReference{}, true
+	case "NullExpression":
+		return &NullExpression{}, true
+	case "NotImplemented":
+		return &NotImplemented{}, true
+	case "UnsupportedExpression":
+		return &UnsupportedExpression{}, true
+	default:
+		return nil, false
+	}
+}
+
+// ParseProgram decodes a program.json document into its typed form.
+func ParseProgram(data []byte) (*ProgramModel, error) {
+	var program ProgramModel
+	if err := decode(data, reflect.ValueOf(&program).Elem()); err != nil {
+		return nil, err
+	}
+	return &program, nil
+}
+
+// ValidateProgramJSON checks that a program.json document has the shape emitted by GenerateProgram: every node and
+// expression has a known "type", every field that is always emitted is present, and every field holds a value of the
+// expected kind. Shape problems are reported as diagnostics; an error is only returned if data is not valid JSON.
+func ValidateProgramJSON(data []byte) (hcl.Diagnostics, error) {
+	var raw json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	var diags hcl.Diagnostics
+	validate(raw, reflect.TypeOf(ProgramModel{}), "", &diags)
+	return diags, nil
+}
+
+// validate checks that data can be decoded into a value of the given type, recording a diagnostic for each problem.
+// Null is accepted for any value. Struct fields are required unless their JSON tag is marked omitempty.
+func validate(data []byte, t reflect.Type, path string, diags *hcl.Diagnostics) {
+	if isNull(data) {
+		return
+	}
+
+	switch {
+	case t == nodeInterface, t == expressionInterface:
+		var header struct {
+			Type *string `json:"type"`
+		}
+		if err := json.Unmarshal(data, &header); err != nil {
+			*diags = append(*diags, invalidJSONValue(path, err))
+			return
+		}
+		if header.Type == nil {
+			*diags = append(*diags, missingJSONField(path, "type"))
+			return
+		}
+
+		var concrete interface{}
+		var ok bool
+		if t == nodeInterface {
+			concrete, ok = newNode(*header.Type)
+		} else {
+			concrete, ok = newExpression(*header.Type)
+		}
+		if !ok {
+			kind := "node"
+			if t == expressionInterface {
+				kind = "expression"
+			}
+			*diags = append(*diags, unknownJSONType(path, kind, *header.Type))
+			return
+		}
+		validate(data, reflect.TypeOf(concrete).Elem(), path, diags)
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		validate(data, t.Elem(), path, diags)
+	case reflect.Slice:
+		var items []json.RawMessage
+		if err := json.Unmarshal(data, &items); err != nil {
+			*diags = append(*diags, invalidJSONValue(path, err))
+			return
+		}
+		for i, item := range items {
+			validate(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i), diags)
+		}
+	case reflect.Map:
+		var entries map[string]json.RawMessage
+		if err := json.Unmarshal(data, &entries); err != nil {
+			*diags = append(*diags, invalidJSONValue(path, err))
+			return
+		}
+		keys := make([]string, 0, len(entries))
+		for key := range entries {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			validate(entries[key], t.Elem(), fieldPath(path, key), diags)
+		}
+	case reflect.Struct:
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(data, &fields); err != nil {
+			*diags = append(*diags, invalidJSONValue(path, err))
+			return
+		}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.Anonymous {
+				validate(data, field.Type, path, diags)
+				continue
+			}
+			tag := strings.Split(field.Tag.Get("json"), ",")
+			raw, ok := fields[tag[0]]
+			switch {
+			case ok:
+				validate(raw, field.Type, fieldPath(path, tag[0]), diags)
+			case len(tag) < 2 || tag[1] != "omitempty":
+				*diags = append(*diags, missingJSONField(path, tag[0]))
+			}
+		}
+	default:
+		if err := unmarshal(data, reflect.New(t).Interface()); err != nil {
+			*diags = append(*diags, invalidJSONValue(path, err))
+		}
+	}
+}
+
+// fieldPath returns the path of the named field of the value at the given path.
+func fieldPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+var (
+	nodeInterface       = reflect.TypeOf((*Node)(nil)).Elem()
+	expressionInterface = reflect.TypeOf((*Expression)(nil)).Elem()
+)
+
+func isNull(data []byte) bool {
+	return bytes.Equal(bytes.TrimSpace(data), []byte("null"))
+}
+
+// decodeDiscriminated decodes a JSON object whose concrete type is determined by its "type" field.
+func decodeDiscriminated(data []byte, kind string, newValue func(string) (reflect.Value, bool)) (reflect.Value, error) {
+	var header struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return reflect.Value{}, err
+	}
+	value, ok := newValue(header.Type)
+	if !ok {
+		return reflect.Value{}, fmt.Errorf("unknown %s type %q", kind, header.Type)
+	}
+	if err := decode(data, value.Elem()); err != nil {
+		return reflect.Value{}, fmt.Errorf("decoding %s: %w", header.Type, err)
+	}
+	return value, nil
+}
+
+// decode decodes data into the given value. Fields of type Node or Expression are decoded into the concrete type
+// named by their "type" discriminator; all other values are decoded by encoding/json.
+func decode(data []byte, value reflect.Value) error {
+	switch {
+	case value.Type() == nodeInterface, value.Type() == expressionInterface:
+		if isNull(data) {
+			return nil
+		}
+
+		var decoded reflect.Value
+		var err error
+		if value.Type() == nodeInterface {
+			decoded, err = decodeDiscriminated(data, "node", func(typ string) (reflect.Value, bool) {
+				node, ok := newNode(typ)
+				return reflect.ValueOf(node), ok
+			})
+		} else {
+			decoded, err = decodeDiscriminated(data, "expression", func(typ string) (reflect.Value, bool) {
+				expr, ok := newExpression(typ)
+				return reflect.ValueOf(expr), ok
+			})
+		}
+		if err != nil {
+			return err
+		}
+		value.Set(decoded)
+		return nil
+	case !containsDiscriminated(value.Type(), map[reflect.Type]bool{}):
+		return unmarshal(data, value.Addr().Interface())
+	}
+
+	switch value.Kind() {
+	case reflect.Ptr:
+		if isNull(data) {
+			return nil
+		}
+		elem := reflect.New(value.Type().Elem())
+		if err := decode(data, elem.Elem()); err != nil {
+			return err
+		}
+		value.Set(elem)
+		return nil
+	case reflect.Slice:
+		if isNull(data) {
+			return nil
+		}
+		var items []json.RawMessage
+		if err := json.Unmarshal(data, &items); err != nil {
+			return err
+		}
+		slice := reflect.MakeSlice(value.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := decode(item, slice.Index(i)); err != nil {
+				return err
+			}
+		}
+		value.Set(slice)
+		return nil
+	case reflect.Map:
+		if isNull(data) {
+			return nil
+		}
+		var entries map[string]json.RawMessage
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return err
+		}
+		m := reflect.MakeMapWithSize(value.Type(), len(entries))
+		for key, entry := range entries {
+			elem := reflect.New(value.Type().Elem()).Elem()
+			if err := decode(entry, elem); err != nil {
+				return err
+			}
+			m.SetMapIndex(reflect.ValueOf(key), elem)
+		}
+		value.Set(m)
+		return nil
+	case reflect.Struct:
+		if isNull(data) {
+			return nil
+		}
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return err
+		}
+		for i := 0; i < value.NumField(); i++ {
+			field := value.Type().Field(i)
+			if field.Anonymous {
+				if err := decode(data, value.Field(i)); err != nil {
+					return err
+				}
+				continue
+			}
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			if raw, ok := fields[name]; ok {
+				if err := decode(raw, value.Field(i)); err != nil {
+					return fmt.Errorf("field %q: %w", name, err)
+				}
+			}
+		}
+		return nil
+	default:
+		return unmarshal(data, value.Addr().Interface())
+	}
+}
+
+// unmarshal decodes data into v, preserving numbers as json.Number so that integers round-trip exactly.
+func unmarshal(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// containsDiscriminated returns true if values of the given type may contain Nodes or Expressions.
+func containsDiscriminated(t reflect.Type, seen map[reflect.Type]bool) bool {
+	if t == nodeInterface || t == expressionInterface {
+		return true
+	}
+	if seen[t] {
+		return false
+	}
+	seen[t] = true
+
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Map:
+		return containsDiscriminated(t.Elem(), seen)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if containsDiscriminated(t.Field(i).Type, seen) {
+				return true
+			}
+		}
+	}
+	return false
+}
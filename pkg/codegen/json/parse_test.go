@@ -0,0 +1,170 @@
+package json
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseProgram(t *testing.T) {
+	t.Parallel()
+
+	program, diags := parseAndBindProgram(t, `
+config names "list(string)" {}
+resource pets "random:index/randomPet:RandomPet" {
+	options { range = length(names) }
+	prefix = names[range.value]
+	keepers = { index = range.value }
+}
+upper = [for n in names: n if n != ""]
+output ids {
+	value = pets[*].id
+}
+output total {
+	value = -length(names) + 1 > 0 ? "many" : "${upper[0]}!"
+}
+`, "program.pp")
+	require.False(t, diags.HasErrors(), "failed to bind program: %v", diags)
+
+	files, _, err := GenerateProgram(program)
+	require.NoError(t, err)
+
+	parsed, err := ParseProgram(files["program.json"])
+	require.NoError(t, err)
+
+	assert.Equal(t, FormatVersion, parsed.FormatVersion)
+	require.Len(t, parsed.Packages, 1)
+	assert.Equal(t, "random", parsed.Packages[0].Name)
+
+	require.Len(t, parsed.Nodes, 5)
+	nodes := map[string]Node{}
+	for _, node := range parsed.Nodes {
+		switch node := node.(type) {
+		case *ConfigVariable:
+			nodes[node.Name] = node
+		case *Resource:
+			nodes[node.Name] = node
+		case *LocalVariable:
+			nodes[node.Name] = node
+		case *OutputVariable:
+			nodes[node.Name] = node
+		}
+	}
+	assert.IsType(t, &ConfigVariable{}, nodes["names"])
+	assert.Nil(t, nodes["names"].(*ConfigVariable).DefaultValue)
+	assert.Equal(t, &Type{Kind: "list", ElementType: &Type{Kind: "string"}}, nodes["names"].(*ConfigVariable).ConfigType)
+
+	pets := nodes["pets"].(*Resource)
+	assert.Equal(t, "random::RandomPet", pets.Token)
+	assert.Equal(t, "length", pets.Options.Range.Expression.(*FunctionCallExpression).Name)
+	assert.True(t, pets.Options.Range.IsCount)
+	prefix := pets.Attributes["prefix"].Value.(*IndexExpression)
+	assert.Equal(t, "names", prefix.Collection.(*ScopeTraversalExpression).RootName)
+	keepers := pets.Attributes["keepers"].Value.(*ObjectConsExpression)
+	require.Len(t, keepers.Properties, 1)
+	assert.Equal(t, "index", keepers.Properties[0].Key.(*LiteralValueExpression).Value)
+
+	upper := nodes["upper"].(*LocalVariable)
+	forExpr := upper.Value.(*ForExpression)
+	assert.Nil(t, forExpr.KeyVariable)
+	assert.Nil(t, forExpr.Key)
+	assert.Equal(t, "n", forExpr.ValueVariable)
+	assert.Equal(t, OperationNotEquals, forExpr.Condition.(*BinaryOpExpression).Operation)
+
+	ids := nodes["ids"].(*OutputVariable)
+	splat := ids.Value.(*SplatExpression)
+	assert.Equal(t, []Traverser{{Type: "TraverseRoot"}, {Type: "TraverseAttr", Name: "id"}},
+		splat.Each.(*ScopeTraversalExpression).Traversal)
+
+	total := nodes["total"].(*OutputVariable)
+	conditional := total.Value.(*ConditionalExpression)
+	comparison := conditional.Condition.(*BinaryOpExpression)
+	assert.Equal(t, OperationGreaterThan, comparison.Operation)
+	sum := comparison.Left.(*BinaryOpExpression)
+	assert.Equal(t, OperationNegate, sum.Left.(*UnaryOpExpression).Operation)
+	assert.Equal(t, json.Number("1"), sum.Right.(*LiteralValueExpression).Value)
+	falseParts := conditional.FalseResult.(*TemplateExpression).Parts
+	require.Len(t, falseParts, 2)
+	require.NotNil(t, falseParts[1].(*LiteralValueExpression).LiteralText)
+	assert.Equal(t, "!", *falseParts[1].(*LiteralValueExpression).LiteralText)
+}
+
+func TestParseProgramUnknownType(t *testing.T) {
+	t.Parallel()
+
+	_, err := ParseProgram([]byte(`{"nodes": [{"type": "Mystery"}], "packages": []}`))
+	assert.EqualError(t, err, `field "nodes": unknown node type "Mystery"`)
+
+	_, err = ParseProgram([]byte(`{
+		"nodes": [{"type": "OutputVariable", "name": "o", "value": {"type": "Mystery"}}],
+		"packages": []
+	}`))
+	assert.EqualError(t, err, `field "nodes": decoding OutputVariable: field "value": unknown expression type "Mystery"`)
+}
+
+func TestValidateProgramJSON(t *testing.T) {
+	t.Parallel()
+
+	program, diags := parseAndBindProgram(t, `
+config names "list(string)" {
+	default = ["a", "b"]
+}
+resource pets "random:index/randomPet:RandomPet" {
+	options {
+		range = length(names)
+		protect = true
+	}
+	prefix = "${names[range.value]}-%{ for n in names }${n},%{ endfor }"
+	keepers = { index = range.value, "first" = names[(0)] }
+}
+resource other "random:index/randomPet:RandomPet" {
+	options { dependsOn = [pets[0]] }
+	length = length(names) > 1 ? 2 : -1
+}
+upper = [for n in names: n if n != ""]
+output ids {
+	value = pets[*].id
+}
+`, "program.pp")
+	require.False(t, diags.HasErrors(), "failed to bind program: %v", diags)
+
+	for _, opts := range []GenerateProgramOptions{
+		{},
+		{IncludeRanges: true, IncludeSourceText: true, IncludeTokens: true, EmbedSchemas: true,
+			IncludeTokenParts: true, NamedArguments: true, ResolveDependsOn: true, OmitPackages: true},
+	} {
+		files, _, err := GenerateProgramWithOptions(program, opts)
+		require.NoError(t, err)
+		diags, err := ValidateProgramJSON(files["program.json"])
+		require.NoError(t, err)
+		assert.Empty(t, diags, "%+v", opts)
+	}
+
+	files, _, err := GenerateProgram(program)
+	require.NoError(t, err)
+	var document map[string]interface{}
+	require.NoError(t, json.Unmarshal(files["program.json"], &document))
+	nodes := document["nodes"].([]interface{})
+
+	// Rename the type of a node, and drop a required field from another.
+	nodes[0].(map[string]interface{})["type"] = "Module"
+	delete(nodes[1].(map[string]interface{}), "name")
+	invalid, err := json.Marshal(document)
+	require.NoError(t, err)
+
+	diags, err = ValidateProgramJSON(invalid)
+	require.NoError(t, err)
+	summaries := make([]string, len(diags))
+	for i, diag := range diags {
+		summaries[i] = diag.Summary
+	}
+	assert.Equal(t, []string{
+		`json-codegen: nodes[0]: unknown node type "Module"`,
+		`json-codegen: nodes[1]: missing required field "name"`,
+	}, summaries)
+
+	_, err = ValidateProgramJSON([]byte(`{"nodes": [`))
+	assert.Error(t, err)
+}
@@ -0,0 +1,92 @@
+package json
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pulumi/pulumi/pkg/v3/codegen/hcl2/syntax"
+	"github.com/pulumi/pulumi/pkg/v3/codegen/pcl"
+	"github.com/pulumi/pulumi/pkg/v3/codegen/testing/utils"
+)
+
+var testdataPath = filepath.Join("..", "testing", "test", "testdata")
+
+func parseAndBindProgram(t testing.TB, text, name string, options ...pcl.BindOption) (*pcl.Program, hcl.Diagnostics) {
+	return parseAndBindFiles(t, map[string]string{name: text}, options...)
+}
+
+// parseAndBindFiles parses the given source files, keyed by filename, and binds them into a single program.
+func parseAndBindFiles(
+	t testing.TB, files map[string]string, options ...pcl.BindOption) (*pcl.Program, hcl.Diagnostics) {
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parser := syntax.NewParser()
+	for _, name := range names {
+		err := parser.ParseFile(strings.NewReader(files[name]), name)
+		if err != nil {
+			t.Fatalf("could not read %v: %v", name, err)
+		}
+	}
+	if parser.Diagnostics.HasErrors() {
+		t.Fatalf("failed to parse files: %v", parser.Diagnostics)
+	}
+
+	options = append(options, pcl.PluginHost(utils.NewHost(testdataPath)))
+
+	program, diags, err := pcl.BindProgram(parser.Files, options...)
+	if err != nil {
+		t.Fatalf("could not bind program: %v", err)
+	}
+	return program, diags
+}
+
+// generateProgramJSON binds the given source, generates program.json, and decodes the result.
+func generateProgramJSON(t *testing.T, text string) map[string]interface{} {
+	program, diags := parseAndBindProgram(t, text, "program.pp")
+	require.False(t, diags.HasErrors(), "failed to bind program: %v", diags)
+
+	files, diags, err := GenerateProgram(program)
+	require.NoError(t, err)
+	require.False(t, diags.HasErrors(), "failed to generate program: %v", diags)
+
+	var tree map[string]interface{}
+	require.NoError(t, json.Unmarshal(files["program.json"], &tree))
+	return tree
+}
+
+// findNode returns the node with the given name from a decoded program tree.
+func findNode(t *testing.T, tree map[string]interface{}, name string) map[string]interface{} {
+	for _, node := range tree["nodes"].([]interface{}) {
+		node := node.(map[string]interface{})
+		if node["name"] == name {
+			return node
+		}
+	}
+	t.Fatalf("could not find node %q", name)
+	return nil
+}
+
+// requireJSONEq asserts that the given decoded value is equal to the expected JSON text.
+func requireJSONEq(t *testing.T, expected string, actual interface{}) {
+	actualJSON, err := json.Marshal(actual)
+	require.NoError(t, err)
+	require.JSONEq(t, expected, string(actualJSON))
+}
+
+// findAttribute returns the value of the named attribute of a decoded resource node.
+func findAttribute(t *testing.T, node map[string]interface{}, name string) interface{} {
+	attribute, ok := node["attributes"].(map[string]interface{})[name].(map[string]interface{})
+	require.True(t, ok, "could not find attribute %q", name)
+	return attribute["value"]
+}
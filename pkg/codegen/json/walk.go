@@ -0,0 +1,50 @@
+// Copyright 2016-2022, Pulumi Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package json
+
+import (
+	"sort"
+)
+
+// Walk traverses a program tree in document order, calling visit for every object that carries a "type"
+// discriminator: nodes, expressions, and traversal parts. The tree may be the result of decoding program.json or any
+// subtree of it. Objects are visited before their contents, and the keys of each object are traversed in sorted
+// order, which matches the order in which they are marshalled. visit may mutate the object it is given; the walk
+// continues into the object's contents as they are after visit returns.
+func Walk(node map[string]interface{}, visit func(node map[string]interface{})) {
+	walkValue(node, visit)
+}
+
+func walkValue(value interface{}, visit func(node map[string]interface{})) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		if _, ok := value["type"].(string); ok {
+			visit(value)
+		}
+
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			walkValue(value[key], visit)
+		}
+	case []interface{}:
+		for _, element := range value {
+			walkValue(element, visit)
+		}
+	}
+}
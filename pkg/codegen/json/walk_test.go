@@ -0,0 +1,58 @@
+package json
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWalk(t *testing.T) {
+	t.Parallel()
+
+	tree := generateProgramJSON(t, `
+config names "list(string)" {}
+
+resource pet "random:index/randomPet:RandomPet" {
+	length = 2
+	keepers = {
+		first = names[0]
+		enabled = true
+	}
+}
+
+output greeting {
+	value = "hello ${pet.id}"
+}
+`)
+
+	// The literals are 2, the "first" and "enabled" keys, true, and the "hello " template part.
+	literals := 0
+	Walk(tree, func(node map[string]interface{}) {
+		if node["type"] == "LiteralValueExpression" {
+			literals++
+		}
+	})
+	assert.Equal(t, 5, literals)
+
+	var order []string
+	Walk(findNode(t, tree, "greeting"), func(node map[string]interface{}) {
+		order = append(order, node["type"].(string))
+	})
+	assert.Equal(t, []string{
+		"OutputVariable",
+		"TemplateExpression",
+		"LiteralValueExpression",
+		"ScopeTraversalExpression",
+		"TraverseRoot",
+		"TraverseAttr",
+	}, order)
+
+	Walk(tree, func(node map[string]interface{}) {
+		if node["type"] == "LiteralValueExpression" && node["value"] == true {
+			node["value"] = false
+		}
+	})
+	keepers := findAttribute(t, findNode(t, tree, "pet"), "keepers").(map[string]interface{})
+	enabled := keepers["properties"].([]interface{})[1].(map[string]interface{})["value"]
+	assert.Equal(t, false, enabled.(map[string]interface{})["value"])
+}